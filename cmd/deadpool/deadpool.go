@@ -2,15 +2,27 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"github.com/armon/go-socks5"
 	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/deadpool/pkg/accesslog"
+	"github.com/wjlin0/deadpool/pkg/admin"
+	"github.com/wjlin0/deadpool/pkg/auth"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/router"
 	"github.com/wjlin0/deadpool/pkg/runner"
-	"net"
-	"strings"
+	"github.com/wjlin0/deadpool/pkg/server"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	// deadpool user add/del/list 管理用户文件
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		os.Exit(runUser(os.Args[2:]))
+	}
+
 	// 解析配置
 	cfgOptions, err := runner.ParserConfigOptions(runner.ParserOptions())
 	if err != nil {
@@ -18,64 +30,164 @@ func main() {
 		return
 	}
 
+	// 收到 SIGINT/SIGTERM 时取消 ctx
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// 初始化代理管理器
-	scpm, err := runner.NewSocksProxyManagerWithFile(cfgOptions, cfgOptions.Options.AliveDataPath)
+	// 加载时会重新检测保存的代理，期间收到退出信号直接退出
+	scpm, err := runner.NewSocksProxyManagerWithFile(ctx, cfgOptions, cfgOptions.Options.AliveDataPath)
+	if ctx.Err() != nil {
+		return
+	}
 	if err != nil {
 		gologger.Fatal().Msg(err.Error())
 		return
 	}
 
 	// 启动自动维护服务
-	dialFunc := scpm.Start()
-
-	//socks.ListenSocksDefault("tcp", ":12345")
-	// 创建SOCKS5服务器配置
-	conf := &socks5.Config{
-		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialFunc(network, addr)
-		},
-		// 如果需要认证，可以在这里配置
-
-	}
-	// 配置认证（如果设置了认证信息）
-	if len(cfgOptions.Listener.Auths) > 0 {
-		creds := socks5.StaticCredentials{}
-		for _, auth := range cfgOptions.Listener.Auths {
-			parts := strings.Split(auth, ":")
-			if len(parts) == 2 {
-				username := strings.TrimSpace(parts[0])
-				password := strings.TrimSpace(parts[1])
-				if username != "" && password != "" {
-					creds[username] = password
-				}
-			}
-		}
+	scpm.Run(ctx)
 
-		// 只有有效的认证信息才设置
-		if len(creds) > 0 {
-			conf.AuthMethods = []socks5.Authenticator{socks5.UserPassAuthenticator{
-				Credentials: creds,
-			}}
-			gologger.Info().Msgf("Enabled SOCKS5 authentication with %d credentials", len(creds))
-		} else {
-			gologger.Warning().Msg("No valid credentials found, running without authentication")
-		}
-	} else {
-		gologger.Info().Msg("Running SOCKS5 server without authentication")
+	// 按规则路由：直连、拒绝或选择代理池
+	rt := router.New(scpm)
+	if err := rt.Apply(cfgOptions); err != nil {
+		gologger.Fatal().Msg(err.Error())
+		return
 	}
 
 	// 创建SOCKS5服务器
-	server, err := socks5.New(conf)
+	srv, err := server.New(cfgOptions.Listener, rt.DialContext)
+	if err != nil {
+		gologger.Fatal().Msg(err.Error())
+		return
+	}
+
+	// 用户配额，流量计数定期保存
+	quotaMgr, err := quota.New(cfgOptions.Options.QuotaDataPath, cfgOptions.Listener.Quotas)
 	if err != nil {
-		gologger.Fatal().Msgf("Failed to create SOCKS5 server: %v", err)
+		gologger.Fatal().Msg(err.Error())
 		return
 	}
+	quotaMgr.Run(ctx)
+	srv.SetQuota(quotaMgr)
+
+	// 用户文件（路径修改后需要重启生效，文件内容修改后自动重新加载）
+	usersFile := cfgOptions.Listener.UsersFile
+	if usersFile != "" {
+		users, err := auth.NewStore(usersFile)
+		if err != nil {
+			gologger.Fatal().Msgf("加载用户文件失败: %v", err)
+			return
+		}
+		if err := quotaMgr.SetUserQuotas(users.Quotas()); err != nil {
+			gologger.Fatal().Msg(err.Error())
+			return
+		}
+		if err := srv.SetUsers(users); err != nil {
+			gologger.Fatal().Msg(err.Error())
+			return
+		}
+		rt.SetPools(func(user string) []string {
+			if u, ok := users.Lookup(user); ok {
+				return u.Pools
+			}
+			return nil
+		})
+		if err := users.Watch(ctx, func() {
+			if err := quotaMgr.SetUserQuotas(users.Quotas()); err != nil {
+				gologger.Error().Msgf("应用用户文件中的配额失败: %v", err)
+			}
+		}); err != nil {
+			gologger.Warning().Msgf("无法监听用户文件变化，用户文件热加载不可用: %v", err)
+		}
+	}
+
+	// 访问日志（修改后需要重启生效）
+	var accessLog *accesslog.Logger
+	if cfgOptions.AccessLog.Enabled {
+		accessLog, err = accesslog.New(cfgOptions.AccessLog)
+		if err != nil {
+			gologger.Fatal().Msg(err.Error())
+			return
+		}
+		srv.SetAccessLog(accessLog)
+		gologger.Info().Msgf("Access log: %s (%s)", cfgOptions.AccessLog.Path, cfgOptions.AccessLog.Format)
+	}
+
+	// 配置文件变化或收到 SIGHUP 时热加载配置，先准备好路由、监听服务与配额的新状态，全部成功后再一起替换，避免只应用一部分
+	if err := runner.WatchConfig(ctx, cfgOptions.Options, func(cfg *types.ConfigOptions) error {
+		if cfg.Listener.UsersFile != usersFile {
+			gologger.Warning().Msgf("用户文件变更为 %q，需要重启后生效", cfg.Listener.UsersFile)
+		}
+		commitRoutes, err := rt.Prepare(cfg)
+		if err != nil {
+			return err
+		}
+		commitListener, err := srv.PrepareReload(cfg.Listener)
+		if err != nil {
+			return err
+		}
+		commitQuotas, err := quotaMgr.PrepareQuotas(cfg.Listener.Quotas)
+		if err != nil {
+			return err
+		}
+		commitRoutes()
+		commitListener()
+		commitQuotas()
+		scpm.ApplyConfig(cfg)
+		return nil
+	}); err != nil {
+		gologger.Warning().Msgf("无法监听配置文件变化，配置热加载不可用: %v", err)
+	}
+
+	// 启动管理 API（独立监听，地址变更需要重启）
+	var adminSrv *admin.Server
+	if cfgOptions.Admin.Enabled {
+		adminSrv = admin.New(cfgOptions.Admin, scpm)
+		adminSrv.SetQuota(quotaMgr)
+		gologger.Info().Msgf("Starting admin API on %s", adminSrv.Addr())
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil {
+				gologger.Error().Msgf("Failed to start admin API: %v", err)
+			}
+		}()
+	}
 
 	// 启动监听
-	listenAddr := fmt.Sprintf("%s:%d", cfgOptions.Listener.IP, cfgOptions.Listener.Port)
-	gologger.Info().Msgf("Starting SOCKS5 server on %s", listenAddr)
+	gologger.Info().Msgf("Starting SOCKS5 server on %s", srv.Addr())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
 
-	if err := server.ListenAndServe("tcp", listenAddr); err != nil {
-		gologger.Fatal().Msgf("Failed to start SOCKS5 server: %v", err)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			gologger.Fatal().Msgf("Failed to start SOCKS5 server: %v", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// 优雅退出：停止接受新连接，在期限内等待隧道结束，停止后台循环并最后保存一次
+	shutdownTimeout := scpm.Config().Listener.ShutdownTimeout
+	gologger.Info().Msgf("收到退出信号，等待活跃连接结束（最长 %d 秒）", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout)*time.Second)
+	defer cancel()
+	if adminSrv != nil {
+		_ = adminSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		gologger.Warning().Msgf("等待连接结束超时: %v", err)
+	}
+	if err := scpm.Close(); err != nil {
+		gologger.Error().Msgf("保存存活代理失败: %v", err)
+	}
+	if err := quotaMgr.Close(); err != nil {
+		gologger.Error().Msgf("保存配额用量失败: %v", err)
+	}
+	if accessLog != nil {
+		_ = accessLog.Close()
 	}
+	gologger.Info().Msg("已退出")
 }
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/auth"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const userUsage = `用法: deadpool user <add|del|list> [参数] [用户名]
+
+  deadpool user add [-f users.htpasswd] [-p 密码] [-sha] [-disabled] [-expires 2026-12-31] [-pools a,b]
+                    [-max-conns N] [-rps N] [-bytes-per-day 10GB] [-bytes-per-month 200GB] [-ports 80,443,8000-9000] <用户名>
+  deadpool user del [-f users.htpasswd] <用户名>
+  deadpool user list [-f users.htpasswd]
+`
+
+// runUser 管理用户文件，返回进程退出码
+func runUser(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, userUsage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "add":
+		err = userAdd(args[1:])
+	case "del":
+		err = userDel(args[1:])
+	case "list":
+		err = userList(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, userUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "deadpool user %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func newUserFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("deadpool user "+name, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, userUsage) }
+	path := fs.String("f", "users.htpasswd", "用户文件")
+	return fs, path
+}
+
+// readUsers 读取用户文件，文件不存在时返回空列表
+func readUsers(path string) ([]*auth.User, error) {
+	users, err := auth.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return users, err
+}
+
+// userAdd 添加用户，用户已存在时更新密码，未指定的元数据保持不变
+func userAdd(args []string) error {
+	fs, path := newUserFlagSet("add")
+	password := fs.String("p", "", "密码，未指定时从标准输入读取一行")
+	sha := fs.Bool("sha", false, "使用 {SHA} 而不是 bcrypt")
+	disabled := fs.Bool("disabled", false, "停用用户")
+	expires := fs.String("expires", "", "过期时间，如 2026-12-31 或 RFC3339，none 表示不过期")
+	pools := fs.String("pools", "", "允许使用的代理池，逗号分隔")
+	maxConns := fs.Int("max-conns", 0, "最大并发连接数")
+	rps := fs.Float64("rps", 0, "每秒最多新建的连接数")
+	perDay := fs.String("bytes-per-day", "", "每天的流量，如 10GB")
+	perMonth := fs.String("bytes-per-month", "", "每月的流量，如 200GB")
+	ports := fs.String("ports", "", "允许的目标端口，逗号分隔，支持范围")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one user name")
+	}
+	name := fs.Arg(0)
+	if name == "" || strings.ContainsAny(name, ": \t") {
+		return fmt.Errorf("invalid user name %q", name)
+	}
+
+	users, err := readUsers(*path)
+	if err != nil {
+		return err
+	}
+	var user *auth.User
+	for _, u := range users {
+		if u.Name == name {
+			user = u
+		}
+	}
+	if user == nil {
+		user = &auth.User{Name: name, Enabled: true}
+		users = append(users, user)
+	}
+
+	if *password == "" {
+		if *password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+	algorithm := auth.HashBcrypt
+	if *sha {
+		algorithm = auth.HashSHA
+	}
+	if user.Hash, err = auth.HashPassword(*password, algorithm); err != nil {
+		return err
+	}
+
+	// 只覆盖命令行中指定的元数据
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if flagErr != nil {
+			return
+		}
+		q := user.Quota
+		if q == nil {
+			q = &types.Quota{}
+		}
+		switch f.Name {
+		case "disabled":
+			user.Enabled = !*disabled
+		case "expires":
+			user.Expires, flagErr = auth.ParseExpires(*expires)
+		case "pools":
+			user.Pools = splitComma(*pools)
+		case "max-conns":
+			q.MaxConns = *maxConns
+		case "rps":
+			q.RequestsPerSecond = *rps
+		case "bytes-per-day":
+			q.BytesPerDay = *perDay
+		case "bytes-per-month":
+			q.BytesPerMonth = *perMonth
+		case "ports":
+			q.AllowedPorts = splitComma(*ports)
+		default:
+			return
+		}
+		if q.MaxConns != 0 || q.RequestsPerSecond != 0 || q.BytesPerDay != "" || q.BytesPerMonth != "" || len(q.AllowedPorts) > 0 {
+			user.Quota = q
+		} else {
+			user.Quota = nil
+		}
+	})
+	if flagErr != nil {
+		return flagErr
+	}
+	if user.Quota != nil {
+		if err := quota.Validate(map[string]*types.Quota{name: user.Quota}); err != nil {
+			return err
+		}
+	}
+
+	if err := auth.WriteFile(*path, users); err != nil {
+		return err
+	}
+	fmt.Printf("已保存用户 %s 到 %s\n", name, *path)
+	return nil
+}
+
+// userDel 删除用户
+func userDel(args []string) error {
+	fs, path := newUserFlagSet("del")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one user name")
+	}
+	users, err := readUsers(*path)
+	if err != nil {
+		return err
+	}
+	kept := users[:0]
+	for _, u := range users {
+		if u.Name != fs.Arg(0) {
+			kept = append(kept, u)
+		}
+	}
+	if len(kept) == len(users) {
+		return fmt.Errorf("user %q not found", fs.Arg(0))
+	}
+	if err := auth.WriteFile(*path, kept); err != nil {
+		return err
+	}
+	fmt.Printf("已删除用户 %s\n", fs.Arg(0))
+	return nil
+}
+
+// userList 列出用户
+func userList(args []string) error {
+	fs, path := newUserFlagSet("list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	users, err := readUsers(*path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tHASH\tSTATE\tEXPIRES\tPOOLS\tQUOTA")
+	for _, u := range users {
+		hash := auth.HashSHA
+		if strings.HasPrefix(u.Hash, "$2") {
+			hash = auth.HashBcrypt
+		}
+		state := "enabled"
+		switch {
+		case !u.Enabled:
+			state = "disabled"
+		case !u.Active(now):
+			state = "expired"
+		}
+		expires := "-"
+		if !u.Expires.IsZero() {
+			expires = u.Expires.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.Name, hash, state, expires, dash(strings.Join(u.Pools, ",")), dash(formatQuota(u.Quota)))
+	}
+	return w.Flush()
+}
+
+func formatQuota(q *types.Quota) string {
+	if q == nil {
+		return ""
+	}
+	var items []string
+	if q.MaxConns > 0 {
+		items = append(items, fmt.Sprintf("conns=%d", q.MaxConns))
+	}
+	if q.RequestsPerSecond > 0 {
+		items = append(items, fmt.Sprintf("rps=%g", q.RequestsPerSecond))
+	}
+	if q.BytesPerDay != "" {
+		items = append(items, "day="+q.BytesPerDay)
+	}
+	if q.BytesPerMonth != "" {
+		items = append(items, "month="+q.BytesPerMonth)
+	}
+	if len(q.AllowedPorts) > 0 {
+		items = append(items, "ports="+strings.Join(q.AllowedPorts, ","))
+	}
+	return strings.Join(items, " ")
+}
+
+// readPassword 从标准输入读取一行作为密码
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
+
+func splitComma(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"io"
+	"strings"
+	"time"
+)
+
+// 访问日志格式
+const (
+	FormatJSON = "json" // 每行一个 JSON 对象
+	FormatText = "text" // 类似 CLF 的文本格式
+)
+
+// Entry 一条访问日志，对应一个客户端连接从建立到关闭的全过程
+type Entry struct {
+	Time        time.Time `json:"time"`                   // 客户端连接建立的时间
+	Listener    string    `json:"listener"`               // 接受连接的监听地址
+	Client      string    `json:"client"`                 // 客户端地址
+	User        string    `json:"user,omitempty"`         // 认证用户
+	Destination string    `json:"destination,omitempty"`  // 目标 host:port
+	Upstream    string    `json:"upstream,omitempty"`     // 选中的上游代理 ip:port
+	ExitIP      string    `json:"exit_ip,omitempty"`      // 上游的出口IP
+	ConnectMs   int64     `json:"connect_ms"`             // 与上游建立隧道的耗时(毫秒)
+	BytesUp     int64     `json:"bytes_up"`               // 客户端 -> 目标的字节数
+	BytesDown   int64     `json:"bytes_down"`             // 目标 -> 客户端的字节数
+	DurationMs  int64     `json:"duration_ms"`            // 连接持续时间(毫秒)
+	Reason      string    `json:"close_reason,omitempty"` // 关闭原因
+}
+
+// Logger 访问日志，写入独立的文件并按大小轮转
+type Logger struct {
+	format string
+	out    io.WriteCloser
+}
+
+// New 根据配置创建访问日志
+func New(cfg *types.AccessLog) (*Logger, error) {
+	out, err := openRotatingFile(cfg.Path, int64(cfg.MaxSize)*1024*1024, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{format: strings.ToLower(cfg.Format), out: out}, nil
+}
+
+// Log 写入一条访问日志
+func (l *Logger) Log(e *Entry) error {
+	var line []byte
+	if l.format == FormatText {
+		line = []byte(e.text())
+	} else {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(data, '\n')
+	}
+	_, err := l.out.Write(line)
+	return err
+}
+
+// Close 关闭日志文件
+func (l *Logger) Close() error {
+	return l.out.Close()
+}
+
+// text 类似 CLF 的格式：
+// client user [time] "CONNECT destination" upstream exit_ip connect_ms bytes_up bytes_down duration_ms listener "close_reason"
+func (e *Entry) text() string {
+	return fmt.Sprintf("%s %s [%s] \"CONNECT %s\" %s %s %d %d %d %d %s %q\n",
+		dash(e.Client), dash(e.User), e.Time.Format("02/Jan/2006:15:04:05 -0700"), dash(e.Destination),
+		dash(e.Upstream), dash(e.ExitIP), e.ConnectMs, e.BytesUp, e.BytesDown, e.DurationMs, dash(e.Listener), e.Reason)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
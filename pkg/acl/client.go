@@ -0,0 +1,115 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+var (
+	// ErrClientDenied 客户端地址在 deny 列表中
+	ErrClientDenied = errors.New("client denied")
+	// ErrClientNotAllowed 配置了 allow 列表且客户端地址不在其中
+	ErrClientNotAllowed = errors.New("client not in allow list")
+)
+
+// Client 监听的客户端地址访问控制，在 SOCKS5 握手之前检查
+type Client struct {
+	allow      []netip.Prefix // 为空表示不限制
+	deny       []netip.Prefix // 优先于 allow
+	authExempt []netip.Prefix // 无需认证的客户端
+}
+
+// NewClient 根据 CIDR 或 IP 列表创建客户端访问控制
+func NewClient(allow, deny, authExempt []string) (*Client, error) {
+	c := &Client{}
+	var err error
+	if c.allow, err = ParsePrefixes(allow); err != nil {
+		return nil, fmt.Errorf("allow: %v", err)
+	}
+	if c.deny, err = ParsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("deny: %v", err)
+	}
+	if c.authExempt, err = ParsePrefixes(authExempt); err != nil {
+		return nil, fmt.Errorf("authExempt: %v", err)
+	}
+	return c, nil
+}
+
+// Check 检查客户端能否连接，拒绝时返回 ErrClientDenied 或 ErrClientNotAllowed
+func (c *Client) Check(ip netip.Addr) error {
+	if p, ok := match(c.deny, ip); ok {
+		return fmt.Errorf("%w by %s", ErrClientDenied, p)
+	}
+	if len(c.allow) > 0 {
+		if _, ok := match(c.allow, ip); !ok {
+			return ErrClientNotAllowed
+		}
+	}
+	return nil
+}
+
+// AuthExempt 判断客户端是否无需认证
+func (c *Client) AuthExempt(ip netip.Addr) bool {
+	_, ok := match(c.authExempt, ip)
+	return ok
+}
+
+// HasAllow 判断是否配置了 allow 列表
+func (c *Client) HasAllow() bool {
+	return len(c.allow) > 0
+}
+
+// HasAuthExempt 判断是否配置了无需认证的客户端
+func (c *Client) HasAuthExempt() bool {
+	return len(c.authExempt) > 0
+}
+
+// ParsePrefixes 解析 CIDR 列表，单个 IP 视为 /32 或 /128
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR or IP %q", v)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR or IP %q", v)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// AddrOf 返回网络地址中的 IP，IPv4 映射的 IPv6 地址转换为 IPv4，无法解析时返回零值
+func AddrOf(addr net.Addr) netip.Addr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.AddrPort().Addr().Unmap()
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ap.Addr().Unmap()
+}
+
+func match(prefixes []netip.Prefix, ip netip.Addr) (netip.Prefix, bool) {
+	if !ip.IsValid() {
+		return netip.Prefix{}, false
+	}
+	ip = ip.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return p, true
+		}
+	}
+	return netip.Prefix{}, false
+}
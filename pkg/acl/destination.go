@@ -0,0 +1,176 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net/netip"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrDestinationDenied 目标地址被规则拒绝
+var ErrDestinationDenied = errors.New("destination denied")
+
+// PresetPrivate 内置规则：本机、私有网络、链路本地(含云厂商元数据地址)与运营商级 NAT 地址
+const PresetPrivate = "private"
+
+var presets = map[string]struct {
+	cidrs   []string
+	domains []string
+}{
+	PresetPrivate: {
+		cidrs: []string{
+			"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+			"::/128", "::1/128", "fc00::/7", "fe80::/10",
+		},
+		domains: []string{"localhost", "*.localhost", "metadata.google.internal"},
+	},
+}
+
+// PortRange 闭区间的端口范围
+type PortRange struct {
+	From, To int
+}
+
+// Contains 判断端口是否在范围内
+func (r PortRange) Contains(port int) bool {
+	return port >= r.From && port <= r.To
+}
+
+// ParsePortRanges 解析端口列表，支持单个端口与 8000-9000 形式的范围
+func ParsePortRanges(ports []string) ([]PortRange, error) {
+	ranges := make([]PortRange, 0, len(ports))
+	for _, p := range ports {
+		from, to, found := strings.Cut(strings.TrimSpace(p), "-")
+		if !found {
+			to = from
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(from))
+		end, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		ranges = append(ranges, PortRange{From: start, To: end})
+	}
+	return ranges, nil
+}
+
+// destinationRule 解析后的目标地址规则
+type destinationRule struct {
+	index    int
+	allow    bool
+	prefixes []netip.Prefix
+	domains  []string // 小写的通配符，* 可以匹配多级子域名
+	ports    []PortRange
+	users    map[string]bool
+}
+
+// Destination 目标地址访问控制，按顺序匹配规则，第一条匹配的规则生效，都不匹配时允许
+type Destination struct {
+	rules []*destinationRule
+}
+
+// NewDestination 解析目标地址规则
+func NewDestination(rules []*types.DestinationRule) (*Destination, error) {
+	d := &Destination{}
+	for i, r := range rules {
+		if r == nil {
+			continue
+		}
+		rule := &destinationRule{index: i + 1}
+		switch strings.ToLower(r.Action) {
+		case "allow":
+			rule.allow = true
+		case "deny":
+		case "":
+			if r.Preset == "" {
+				return nil, fmt.Errorf("rule %d: action must be allow or deny", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: action must be allow or deny, got %q", i+1, r.Action)
+		}
+
+		cidrs, domains := r.CIDRs, r.Domains
+		if r.Preset != "" {
+			preset, ok := presets[strings.ToLower(r.Preset)]
+			if !ok {
+				return nil, fmt.Errorf("rule %d: unknown preset %q", i+1, r.Preset)
+			}
+			cidrs = append(append([]string(nil), cidrs...), preset.cidrs...)
+			domains = append(append([]string(nil), domains...), preset.domains...)
+		}
+
+		var err error
+		if rule.prefixes, err = ParsePrefixes(cidrs); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		for _, domain := range domains {
+			domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+			if _, err := path.Match(domain, ""); err != nil || domain == "" {
+				return nil, fmt.Errorf("rule %d: invalid domain %q", i+1, domain)
+			}
+			rule.domains = append(rule.domains, domain)
+		}
+		if rule.ports, err = ParsePortRanges(r.Ports); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if len(r.Users) > 0 {
+			rule.users = make(map[string]bool, len(r.Users))
+			for _, u := range r.Users {
+				rule.users[u] = true
+			}
+		}
+		d.rules = append(d.rules, rule)
+	}
+	return d, nil
+}
+
+// Check 检查用户能否访问目标，fqdn 为客户端请求的域名(请求 IP 时为空)，ip 为目标 IP(未解析时为零值)
+func (d *Destination) Check(user, fqdn string, ip netip.Addr, port int) error {
+	fqdn = strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	ip = ip.Unmap()
+	for _, r := range d.rules {
+		if r.match(user, fqdn, ip, port) {
+			if r.allow {
+				return nil
+			}
+			return fmt.Errorf("%w by rule %d", ErrDestinationDenied, r.index)
+		}
+	}
+	return nil
+}
+
+func (r *destinationRule) match(user, fqdn string, ip netip.Addr, port int) bool {
+	if r.users != nil && !r.users[user] {
+		return false
+	}
+	if len(r.ports) > 0 {
+		matched := false
+		for _, p := range r.ports {
+			if p.Contains(port) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	// 同时配置了 CIDR 与域名时满足其一即可
+	if len(r.prefixes) == 0 && len(r.domains) == 0 {
+		return true
+	}
+	if _, ok := match(r.prefixes, ip); ok {
+		return true
+	}
+	if fqdn != "" {
+		for _, pattern := range r.domains {
+			if ok, _ := path.Match(pattern, fqdn); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
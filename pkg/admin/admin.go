@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/metrics"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/runner"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Server 管理 API 与 Web 面板服务，与 SOCKS5 监听分开，所有 API 请求都需要携带 token
+type Server struct {
+	manager *runner.SocksProxyManager
+	quota   *quota.Manager // 用户配额，未设置时 /api/quotas 返回空列表
+	http    *http.Server
+	done    chan struct{} // Shutdown 时关闭，用于结束事件流等长连接
+}
+
+// New 根据管理 API 配置创建服务，token 每次请求时从管理器的当前配置读取，热加载后立即生效
+// 同时以该管理器的代理池与代理源作为 /metrics 中代理池与代理源健康指标的数据来源
+func New(cfg *types.Admin, manager *runner.SocksProxyManager) *Server {
+	metrics.SetPoolFunc(manager.PoolGroups)
+	metrics.SetSourceFunc(manager.SourceHealths)
+	s := &Server{manager: manager, done: make(chan struct{})}
+	s.http = &http.Server{
+		Addr:              net.JoinHostPort(cfg.IP, fmt.Sprint(cfg.Port)),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// http.Server.Shutdown 不会中断处理中的请求，需要主动通知事件流退出
+	s.http.RegisterOnShutdown(func() { close(s.done) })
+	return s
+}
+
+// SetQuota 设置用户配额管理器，需要在开始监听前调用
+func (s *Server) SetQuota(q *quota.Manager) {
+	s.quota = q
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() string {
+	return s.http.Addr
+}
+
+// ListenAndServe 开始监听，调用 Shutdown 后返回 nil
+func (s *Server) ListenAndServe() error {
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Serve 在指定的 listener 上处理请求，调用 Shutdown 后返回 nil
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.http.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 停止接受新请求并等待处理中的请求结束
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+// Handler 返回管理 API、/metrics 与 Web 面板的路由，/api/ 与 /metrics 需要校验 token，面板静态资源无需校验
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(s.apiHandler()))
+	mux.Handle("GET /metrics", s.authenticate(metrics.Handler()))
+	mux.Handle("/", dashboardHandler())
+	return mux
+}
+
+// apiHandler 返回管理 API 的路由
+func (s *Server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/proxies", s.handleListProxies)
+	mux.HandleFunc("POST /api/proxies", s.handleAddProxies)
+	mux.HandleFunc("GET /api/proxy", s.handleGetProxy)
+	mux.HandleFunc("DELETE /api/proxy", s.handleDeleteProxy)
+	mux.HandleFunc("PATCH /api/proxy", s.handleUpdateProxy)
+	mux.HandleFunc("POST /api/proxy/recheck", s.handleRecheckProxy)
+	mux.HandleFunc("GET /api/sources", s.handleListSources)
+	mux.HandleFunc("POST /api/sources/{name}/fetch", s.handleFetchSource)
+	mux.HandleFunc("GET /api/quotas", s.handleListQuotas)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	return mux
+}
+
+// authenticate 校验 Authorization: Bearer <token>，浏览器的 EventSource 等无法设置请求头的场景可以使用 ?token=
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := ""
+		if cfg := s.manager.Config(); cfg != nil && cfg.Admin != nil {
+			expected = cfg.Admin.Token
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON 以 JSON 格式返回数据
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError 以 {"error": "..."} 格式返回错误
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webFS Web 面板的静态资源，编译进二进制文件
+//
+//go:embed web
+var webFS embed.FS
+
+// dashboardHandler 返回 Web 面板静态资源的处理器，页面本身不包含数据，数据由页面携带 token 调用 API 获取
+func dashboardHandler() http.Handler {
+	sub, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServerFS(sub)
+}
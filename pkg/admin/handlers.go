@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/runner"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxAddProxies 单次添加请求允许的最大代理数
+const maxAddProxies = 1000
+
+// handleStatus GET /api/status 返回代理池的整体统计
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.manager.Stats())
+}
+
+// handleListProxies GET /api/proxies?source=&alive=&country=&max_latency= 按条件列出代理，max_latency 单位为毫秒
+func (s *Server) handleListProxies(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := runner.ProxyFilter{
+		Source:  q.Get("source"),
+		Country: q.Get("country"),
+	}
+	if v := q.Get("alive"); v != "" {
+		alive, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid alive: %v", err))
+			return
+		}
+		filter.Alive = &alive
+	}
+	if v := q.Get("max_latency"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid max_latency: %q", v))
+			return
+		}
+		filter.MaxLatency = time.Duration(ms) * time.Millisecond
+	}
+	writeJSON(w, http.StatusOK, s.manager.Proxies(filter))
+}
+
+// addProxiesRequest POST /api/proxies 的请求体
+type addProxiesRequest struct {
+	URLs   []string `json:"urls"`
+	Source string   `json:"source"` // 来源标识，默认为 manual
+}
+
+// addProxyResult 单个代理的添加结果
+type addProxyResult struct {
+	URL   string            `json:"url"`
+	Added bool              `json:"added"` // 是否通过检测并加入代理池
+	Proxy *runner.ProxyInfo `json:"proxy,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+// handleAddProxies POST /api/proxies 检测并添加代理，检测完成后返回每个代理的结果
+func (s *Server) handleAddProxies(w http.ResponseWriter, r *http.Request) {
+	var req addProxiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+		return
+	}
+	if len(req.URLs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("urls is required"))
+		return
+	}
+	if len(req.URLs) > maxAddProxies {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("at most %d urls per request", maxAddProxies))
+		return
+	}
+	if req.Source == "" {
+		req.Source = "manual"
+	}
+
+	results := make([]addProxyResult, len(req.URLs))
+	var wg sync.WaitGroup
+	for i, u := range req.URLs {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			results[i].URL = u
+			s.manager.AddProxy(r.Context(), u, req.Source)
+			if p, ok := s.manager.Proxy(u); ok && p.IsAlive {
+				results[i].Added = true
+				results[i].Proxy = p
+			} else {
+				results[i].Error = "proxy check failed"
+			}
+		}(i, u)
+	}
+	wg.Wait()
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleGetProxy GET /api/proxy?url= 返回单个代理
+func (s *Server) handleGetProxy(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.manager.Proxy(r.URL.Query().Get("url"))
+	if !ok {
+		writeError(w, http.StatusNotFound, runner.ErrProxyNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// handleDeleteProxy DELETE /api/proxy?url= 从代理池中删除代理
+func (s *Server) handleDeleteProxy(w http.ResponseWriter, r *http.Request) {
+	if !s.manager.RemoveProxy(r.URL.Query().Get("url")) {
+		writeError(w, http.StatusNotFound, runner.ErrProxyNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateProxyRequest PATCH /api/proxy 的请求体，未设置的字段保持不变
+type updateProxyRequest struct {
+	Disabled *bool `json:"disabled"`
+	Pinned   *bool `json:"pinned"`
+}
+
+// handleUpdateProxy PATCH /api/proxy?url= 停用/启用、固定/取消固定代理
+func (s *Server) handleUpdateProxy(w http.ResponseWriter, r *http.Request) {
+	proxyURL := r.URL.Query().Get("url")
+	var req updateProxyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+		return
+	}
+	if _, ok := s.manager.Proxy(proxyURL); !ok {
+		writeError(w, http.StatusNotFound, runner.ErrProxyNotFound)
+		return
+	}
+	if req.Disabled != nil {
+		s.manager.SetDisabled(proxyURL, *req.Disabled)
+	}
+	if req.Pinned != nil {
+		s.manager.SetPinned(proxyURL, *req.Pinned)
+	}
+	s.handleGetProxy(w, r)
+}
+
+// handleRecheckProxy POST /api/proxy/recheck?url= 立即重新检测代理并返回结果
+func (s *Server) handleRecheckProxy(w http.ResponseWriter, r *http.Request) {
+	p, err := s.manager.Recheck(r.Context(), r.URL.Query().Get("url"))
+	if errors.Is(err, runner.ErrProxyNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	// 检测失败也返回代理的最新状态(is_alive 为 false)
+	writeJSON(w, http.StatusOK, p)
+}
+
+// handleListSources GET /api/sources 返回所有代理源的状态
+func (s *Server) handleListSources(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.manager.SourceStatuses())
+}
+
+// handleFetchSource POST /api/sources/{name}/fetch 立即在后台从代理源获取一次代理
+func (s *Server) handleFetchSource(w http.ResponseWriter, r *http.Request) {
+	if err := s.manager.FetchSource(r.PathValue("name")); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, runner.ErrManagerClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleListQuotas GET /api/quotas 返回各认证用户的当前用量与配额
+func (s *Server) handleListQuotas(w http.ResponseWriter, r *http.Request) {
+	if s.quota == nil {
+		writeJSON(w, http.StatusOK, []quota.Usage{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.quota.Usage())
+}
+
+// handleEvents GET /api/events 以 Server-Sent Events 推送实时连接事件，连接建立时先推送最近的事件
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	events, cancel := s.manager.SubscribeConnEvents()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e runner.ConnEvent) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+	for _, e := range s.manager.RecentConnEvents() {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	// 定期发送注释行保持连接，避免被中间代理断开
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e := <-events:
+			if err := send(e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,221 @@
+'use strict';
+
+// 延迟分布的分桶上限（毫秒），最后一个桶为无上限
+const BUCKETS = [100, 300, 500, 1000, 2000, 5000, Infinity];
+const MAX_FEED = 200;
+const REFRESH_INTERVAL = 5000;
+
+let token = localStorage.getItem('deadpool-token') || '';
+let events = null;
+let timer = null;
+
+const $ = (id) => document.getElementById(id);
+
+function message(text) {
+    $('message').textContent = text || '';
+}
+
+async function api(method, path) {
+    const resp = await fetch(path, {
+        method,
+        headers: {Authorization: 'Bearer ' + token},
+    });
+    if (resp.status === 401) {
+        throw new Error('访问令牌无效');
+    }
+    if (!resp.ok && resp.status !== 404) {
+        throw new Error(method + ' ' + path + ': ' + resp.status);
+    }
+    return resp.status === 204 || resp.status === 202 ? null : resp.json();
+}
+
+function ms(ns) {
+    return Math.round(ns / 1e6);
+}
+
+function formatTime(value) {
+    if (!value || value.startsWith('0001-')) {
+        return '-';
+    }
+    return new Date(value).toLocaleString();
+}
+
+// el 创建元素，children 为字符串时作为文本
+function el(tag, attrs, children) {
+    const node = document.createElement(tag);
+    Object.assign(node, attrs || {});
+    for (const child of [].concat(children || [])) {
+        node.append(child);
+    }
+    return node;
+}
+
+function button(text, onclick) {
+    return el('button', {type: 'button', onclick}, text);
+}
+
+function renderStatus(stats) {
+    $('alive').textContent = stats.alive;
+    $('dead').textContent = stats.total - stats.alive;
+    $('disabled').textContent = stats.disabled;
+    $('pinned').textContent = stats.pinned;
+    $('check-limit').textContent = stats.check_limit;
+}
+
+function renderHistogram(proxies) {
+    const counts = BUCKETS.map(() => 0);
+    for (const p of proxies) {
+        if (!p.is_alive) {
+            continue;
+        }
+        const i = BUCKETS.findIndex((limit) => ms(p.latency || 0) < limit);
+        counts[i]++;
+    }
+    const max = Math.max(1, ...counts);
+    const bars = BUCKETS.map((limit, i) => {
+        const from = i === 0 ? 0 : BUCKETS[i - 1];
+        const name = limit === Infinity ? '≥ ' + from + 'ms' : from + '-' + limit + 'ms';
+        return el('div', {className: 'bar'}, [
+            el('span', {className: 'name'}, name),
+            el('span', {className: 'fill', style: 'width:' + (counts[i] / max * 70) + '%'}),
+            el('span', {}, String(counts[i])),
+        ]);
+    });
+    $('histogram').replaceChildren(...bars);
+}
+
+const healthNames = {healthy: '正常', degraded: '降级', failing: '失败'};
+
+function sourceHealth(s) {
+    let text = healthNames[s.health] || s.health;
+    if (!s.available) {
+        text += ' · ' + formatTime(s.next_retry) + ' 重试';
+    }
+    return text;
+}
+
+function sourceYield(s) {
+    if (s.yield < 0) {
+        return '-';
+    }
+    return (s.yield * 100).toFixed(1) + '% (' + s.accepted + ' / ' + s.fetched + ')';
+}
+
+function renderSources(sources) {
+    const select = $('filter-source');
+    const selected = select.value;
+    select.replaceChildren(el('option', {value: ''}, '全部来源'),
+        ...sources.map((s) => el('option', {value: s.name, selected: s.name === selected}, s.name)));
+
+    const rows = sources.map((s) => el('tr', {}, [
+        el('td', {}, s.name),
+        el('td', {className: s.health === 'healthy' ? 'ok' : 'bad', title: s.last_error || ''}, sourceHealth(s)),
+        el('td', {}, s.alive + ' / ' + s.proxies),
+        el('td', {title: '优先级 ' + s.priority + ' · 成本 ' + s.cost}, sourceYield(s)),
+        el('td', {}, formatTime(s.last_fetch)),
+        el('td', {}, button('立即获取', () => action('POST', '/api/sources/' + encodeURIComponent(s.name) + '/fetch'))),
+    ]));
+    $('sources').replaceChildren(...rows);
+}
+
+function renderProxies(proxies) {
+    const rows = proxies.map((p) => {
+        const id = encodeURIComponent(p.url);
+        let state = p.is_alive ? '存活' : '失效';
+        if (p.disabled) {
+            state += ' · 停用';
+        }
+        if (p.pinned) {
+            state += ' · 固定';
+        }
+        return el('tr', {}, [
+            el('td', {}, p.ip + ':' + p.port),
+            el('td', {}, p.source || '-'),
+            el('td', {}, p.country || '-'),
+            el('td', {}, p.exit_ip || '-'),
+            el('td', {}, p.latency ? ms(p.latency) + 'ms' : '-'),
+            el('td', {className: p.is_alive ? 'ok' : 'bad'}, state),
+            el('td', {}, formatTime(p.last_checked)),
+            el('td', {}, [
+                button('复检', () => action('POST', '/api/proxy/recheck?url=' + id)),
+                button('删除', () => confirm('删除 ' + p.ip + ':' + p.port + '？') && action('DELETE', '/api/proxy?url=' + id)),
+            ]),
+        ]);
+    });
+    $('proxies').replaceChildren(...rows);
+}
+
+async function action(method, path) {
+    try {
+        await api(method, path);
+        await refresh();
+    } catch (e) {
+        message(e.message);
+    }
+}
+
+async function refresh() {
+    const params = new URLSearchParams();
+    if ($('filter-alive').value) {
+        params.set('alive', $('filter-alive').value);
+    }
+    if ($('filter-source').value) {
+        params.set('source', $('filter-source').value);
+    }
+    try {
+        const [stats, sources, all, proxies] = await Promise.all([
+            api('GET', '/api/status'),
+            api('GET', '/api/sources'),
+            api('GET', '/api/proxies?alive=true'),
+            api('GET', '/api/proxies?' + params),
+        ]);
+        renderStatus(stats);
+        renderSources(sources);
+        renderHistogram(all);
+        renderProxies(proxies);
+        message('');
+    } catch (e) {
+        message(e.message);
+    }
+}
+
+function appendEvent(e) {
+    const time = new Date(e.time).toLocaleTimeString();
+    const text = e.success
+        ? time + ' success -> ' + e.proxy + ' -> ' + e.target + ' -> ' + (e.exit_ip || '-') + ' (' + ms(e.latency) + 'ms)'
+        : time + ' error -> ' + (e.proxy || '-') + ' -> ' + e.target + ' -> ' + e.error;
+    const feed = $('feed');
+    feed.prepend(el('li', {className: e.success ? 'ok' : 'bad'}, text));
+    while (feed.children.length > MAX_FEED) {
+        feed.lastChild.remove();
+    }
+}
+
+function connect() {
+    if (events) {
+        events.close();
+    }
+    clearInterval(timer);
+    $('feed').replaceChildren();
+
+    // EventSource 无法设置请求头，通过查询参数传递令牌
+    events = new EventSource('/api/events?token=' + encodeURIComponent(token));
+    events.onmessage = (msg) => appendEvent(JSON.parse(msg.data));
+
+    refresh();
+    timer = setInterval(refresh, REFRESH_INTERVAL);
+}
+
+$('login').addEventListener('submit', (e) => {
+    e.preventDefault();
+    token = $('token').value;
+    localStorage.setItem('deadpool-token', token);
+    connect();
+});
+$('filter-alive').addEventListener('change', refresh);
+$('filter-source').addEventListener('change', refresh);
+
+$('token').value = token;
+if (token) {
+    connect();
+}
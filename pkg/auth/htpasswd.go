@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的密码哈希
+const (
+	HashBcrypt = "bcrypt" // htpasswd -B
+	HashSHA    = "sha"    // htpasswd -s，{SHA} + base64(sha1)
+)
+
+// dateLayout 过期时间只写日期时的格式，当天结束后过期
+const dateLayout = "2006-01-02"
+
+// User 用户文件中的一个用户
+// 每行格式为 name:hash[:metadata]，前两列与 htpasswd 兼容，第三列为可选的元数据，如
+// alice:$2y$10$...:enabled=false,expires=2026-12-31,pools=cn|us,maxConns=10,bytesPerDay=10GB,ports=80|443
+type User struct {
+	Name    string
+	Hash    string
+	Enabled bool
+	Expires time.Time    // 零值表示不过期
+	Pools   []string     // 允许使用的代理池，为空表示不限制
+	Quota   *types.Quota // 用户配额，优先于 listener.quotas 中的配置，nil 表示沿用 listener.quotas
+}
+
+// Active 判断用户在 now 时是否可用
+func (u *User) Active(now time.Time) bool {
+	return u.Enabled && (u.Expires.IsZero() || now.Before(u.Expires))
+}
+
+// Verify 校验密码
+func (u *User) Verify(password string) bool {
+	switch {
+	case strings.HasPrefix(u.Hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(u.Hash), []byte(password)) == nil
+	case strings.HasPrefix(u.Hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(u.Hash), []byte(expected)) == 1
+	}
+	return false
+}
+
+// HashPassword 使用指定的算法计算密码哈希
+func HashPassword(password, algorithm string) (string, error) {
+	switch algorithm {
+	case "", HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case HashSHA:
+		sum := sha1.Sum([]byte(password))
+		return "{SHA}" + base64.StdEncoding.EncodeToString(sum[:]), nil
+	}
+	return "", fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// ReadFile 读取用户文件，忽略空行与 # 开头的注释
+func ReadFile(path string) ([]*User, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+func parse(r io.Reader) ([]*User, error) {
+	var users []*User
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if seen[u.Name] {
+			return nil, fmt.Errorf("line %d: duplicate user %q", n, u.Name)
+		}
+		seen[u.Name] = true
+		users = append(users, u)
+	}
+	return users, scanner.Err()
+}
+
+func parseLine(line string) (*User, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, errors.New("expected name:hash")
+	}
+	hash, meta, _ := strings.Cut(rest, ":")
+	if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+		return nil, fmt.Errorf("unsupported hash for user %q, only bcrypt and {SHA} are supported", name)
+	}
+	u := &User{Name: name, Hash: hash, Enabled: true}
+	if meta == "" {
+		return u, nil
+	}
+
+	q := &types.Quota{}
+	hasQuota := false
+	for _, item := range strings.Split(meta, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		var err error
+		switch key {
+		case "enabled":
+			u.Enabled, err = strconv.ParseBool(value)
+		case "expires":
+			u.Expires, err = ParseExpires(value)
+		case "pools":
+			u.Pools = splitList(value)
+		case "maxConns":
+			q.MaxConns, err = strconv.Atoi(value)
+			hasQuota = true
+		case "requestsPerSecond":
+			q.RequestsPerSecond, err = strconv.ParseFloat(value, 64)
+			hasQuota = true
+		case "bytesPerDay":
+			q.BytesPerDay, hasQuota = value, true
+		case "bytesPerMonth":
+			q.BytesPerMonth, hasQuota = value, true
+		case "ports":
+			q.AllowedPorts, hasQuota = splitList(value), true
+		default:
+			return nil, fmt.Errorf("unknown metadata %q for user %q", key, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for user %q: %v", key, name, err)
+		}
+	}
+	if hasQuota {
+		if err := quota.Validate(map[string]*types.Quota{name: q}); err != nil {
+			return nil, err
+		}
+		u.Quota = q
+	}
+	return u, nil
+}
+
+// ParseExpires 解析过期时间，支持日期(当天结束后过期)与 RFC3339，空字符串或 none 表示不过期
+func ParseExpires(value string) (time.Time, error) {
+	if value == "" || value == "none" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(dateLayout, value, time.Local); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// WriteFile 按用户名排序写入用户文件，没有元数据的用户只写 name:hash，与 htpasswd 保持兼容
+func WriteFile(path string, users []*User) error {
+	sorted := append([]*User(nil), users...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b strings.Builder
+	for _, u := range sorted {
+		b.WriteString(u.Name + ":" + u.Hash)
+		if meta := u.metadata(); meta != "" {
+			b.WriteString(":" + meta)
+		}
+		b.WriteString("\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	// 先写临时文件再重命名，监听方不会读到写了一半的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// metadata 返回第三列的元数据，只包含非默认值
+func (u *User) metadata() string {
+	var items []string
+	if !u.Enabled {
+		items = append(items, "enabled=false")
+	}
+	if !u.Expires.IsZero() {
+		// 当天结束时过期的写为日期，与读取时保持一致
+		if day := u.Expires.AddDate(0, 0, -1); day.Equal(time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)) {
+			items = append(items, "expires="+day.Format(dateLayout))
+		} else {
+			items = append(items, "expires="+u.Expires.Format(time.RFC3339))
+		}
+	}
+	if len(u.Pools) > 0 {
+		items = append(items, "pools="+strings.Join(u.Pools, "|"))
+	}
+	if q := u.Quota; q != nil {
+		if q.MaxConns > 0 {
+			items = append(items, "maxConns="+strconv.Itoa(q.MaxConns))
+		}
+		if q.RequestsPerSecond > 0 {
+			items = append(items, "requestsPerSecond="+strconv.FormatFloat(q.RequestsPerSecond, 'f', -1, 64))
+		}
+		if q.BytesPerDay != "" {
+			items = append(items, "bytesPerDay="+q.BytesPerDay)
+		}
+		if q.BytesPerMonth != "" {
+			items = append(items, "bytesPerMonth="+q.BytesPerMonth)
+		}
+		if len(q.AllowedPorts) > 0 {
+			items = append(items, "ports="+strings.Join(q.AllowedPorts, "|"))
+		}
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/fsnotify/fsnotify"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reloadDebounce 用户文件连续变化时合并为一次加载的等待时间
+const reloadDebounce = 500 * time.Millisecond
+
+// Store 基于用户文件的认证信息，文件变化后自动重新加载
+type Store struct {
+	path  string
+	users atomic.Pointer[map[string]*User]
+
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte // 用户名 -> 最近一次校验通过的密码摘要，避免每个连接都计算 bcrypt
+}
+
+// NewStore 加载用户文件
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path 返回用户文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Reload 重新加载用户文件，文件无效时保留当前的用户
+func (s *Store) Reload() error {
+	list, err := ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	users := make(map[string]*User, len(list))
+	for _, u := range list {
+		users[u.Name] = u
+	}
+	s.mu.Lock()
+	s.users.Store(&users)
+	s.verified = make(map[string][sha256.Size]byte)
+	s.mu.Unlock()
+	return nil
+}
+
+// Lookup 返回用户，不存在时返回 false
+func (s *Store) Lookup(name string) (*User, bool) {
+	u, ok := (*s.users.Load())[name]
+	return u, ok
+}
+
+// Len 返回用户数
+func (s *Store) Len() int {
+	return len(*s.users.Load())
+}
+
+// Valid 校验用户名与密码，停用或过期的用户校验失败，实现 socks5.CredentialStore
+func (s *Store) Valid(name, password string) bool {
+	u, ok := s.Lookup(name)
+	if !ok || !u.Active(time.Now()) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(password))
+	s.mu.Lock()
+	cached, ok := s.verified[name]
+	s.mu.Unlock()
+	if ok && cached == sum {
+		return true
+	}
+	if !u.Verify(password) {
+		return false
+	}
+	s.mu.Lock()
+	// 期间重新加载过时不写入，避免把旧密码记入新的缓存
+	if current, _ := s.Lookup(name); current == u {
+		s.verified[name] = sum
+	}
+	s.mu.Unlock()
+	return true
+}
+
+// Quotas 返回用户文件中配置了配额的用户
+func (s *Store) Quotas() map[string]*types.Quota {
+	quotas := make(map[string]*types.Quota)
+	for name, u := range *s.users.Load() {
+		if u.Quota != nil {
+			quotas[name] = u.Quota
+		}
+	}
+	return quotas
+}
+
+// Watch 监听用户文件的变化，重新加载成功后调用 onReload；ctx 取消后停止监听
+func (s *Store) Watch(ctx context.Context, onReload func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听所在目录而不是文件本身，编辑器与 deadpool user 都以重命名方式替换文件
+	path, err := filepath.Abs(s.path)
+	if err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path {
+					continue
+				}
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+					debounce = time.After(reloadDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				if err := s.Reload(); err != nil {
+					gologger.Error().Msgf("用户文件无效，保留当前用户: %v", err)
+					continue
+				}
+				gologger.Info().Msgf("用户文件已重新加载: %d 个用户", s.Len())
+				if onReload != nil {
+					onReload()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				gologger.Warning().Msgf("监听用户文件失败: %v", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package deadpool 提供可嵌入到其他 Go 程序中的代理池
+//
+//	pool, err := deadpool.New(deadpool.WithProxies("socks5://127.0.0.1:1080"))
+//	if err != nil { ... }
+//	if err := pool.Start(ctx); err != nil { ... }
+//	defer pool.Close()
+//	client := pool.HTTPClient(10 * time.Second)
+package deadpool
+
+import (
+	"context"
+	"errors"
+	"github.com/wjlin0/deadpool/pkg/runner"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"golang.org/x/net/proxy"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// seedSource 通过 WithProxies 添加的代理的来源标识
+const seedSource = "seed"
+
+// Pool 由 SocksProxyManager 支撑的代理池
+type Pool struct {
+	config        *types.ConfigOptions
+	logger        types.Logger
+	aliveDataPath string
+	seeds         []string
+
+	manager *runner.SocksProxyManager
+	mu      sync.Mutex
+	started bool
+	closed  bool
+}
+
+// New 创建代理池，默认不启用任何代理源、不持久化、不输出日志
+func New(opts ...Option) (*Pool, error) {
+	cfg := runner.DefaultConfigOptions()
+	cfg.SourcesConfig = &types.SourcesConfig{
+		CheckerProxy: &types.CheckerProxy{Enabled: false},
+	}
+
+	p := &Pool{
+		config: cfg,
+		logger: types.NopLogger(),
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if err := runner.NormalizeConfigOptions(p.config); err != nil {
+		return nil, err
+	}
+	p.config.Options = &types.Options{AliveDataPath: p.aliveDataPath}
+
+	p.manager = runner.NewSocksProxyManager(p.config)
+	p.manager.SetLogger(p.logger)
+	return p, nil
+}
+
+// Start 启动后台循环，加载持久化的代理并检测 WithProxies 添加的代理
+// 返回时初始代理已经检测完毕；ctx 取消或调用 Close 后后台循环全部退出
+func (p *Pool) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errors.New("deadpool: pool is closed")
+	}
+	if p.started {
+		return errors.New("deadpool: pool already started")
+	}
+	p.started = true
+
+	p.manager.Run(ctx)
+	if p.aliveDataPath != "" {
+		if err := p.manager.LoadFromFile(p.aliveDataPath); err != nil {
+			return err
+		}
+	}
+	if len(p.seeds) > 0 {
+		p.manager.AddProxies(p.seeds, seedSource)
+	}
+	return nil
+}
+
+// Close 停止所有后台循环，配置了持久化文件时最后保存一次
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if !p.started {
+		return nil
+	}
+	return p.manager.Close()
+}
+
+// Manager 返回底层的代理管理器
+func (p *Pool) Manager() *runner.SocksProxyManager {
+	return p.manager
+}
+
+// Alive 返回当前存活的代理数量
+func (p *Pool) Alive() int {
+	return p.manager.AliveProxy()
+}
+
+// Dial 经由代理池中的下一个可用代理建立连接
+func (p *Pool) Dial(network, addr string) (net.Conn, error) {
+	return p.manager.DialContext(context.Background(), network, addr)
+}
+
+// DialContext 经由代理池中的下一个可用代理建立连接
+func (p *Pool) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return p.manager.DialContext(ctx, network, addr)
+}
+
+// ContextDialer 返回由代理池支撑的 proxy.ContextDialer
+func (p *Pool) ContextDialer() proxy.ContextDialer {
+	return p
+}
+
+// RoundTripper 返回所有连接都经由代理池建立的 http.RoundTripper
+func (p *Pool) RoundTripper() http.RoundTripper {
+	return &http.Transport{
+		DialContext:           p.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// HTTPClient 返回经由代理池发起请求的 http.Client，timeout 为 0 表示不限制
+func (p *Pool) HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: p.RoundTripper(),
+		Timeout:   timeout,
+	}
+}
@@ -0,0 +1,112 @@
+package deadpool
+
+import (
+	"github.com/wjlin0/deadpool/pkg/runner"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"time"
+)
+
+// Option 配置代理池的函数式选项
+type Option func(p *Pool) error
+
+// WithConfig 以一份配置为基础(未配置的项使用默认值)，应作为第一个选项，之后的选项在其上修改
+func WithConfig(cfg *types.ConfigOptions) Option {
+	return func(p *Pool) error {
+		if err := runner.NormalizeConfigOptions(cfg); err != nil {
+			return err
+		}
+		p.config = cfg
+		return nil
+	}
+}
+
+// WithLogger 设置日志实现，默认丢弃所有日志
+func WithLogger(logger types.Logger) Option {
+	return func(p *Pool) error {
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithAliveDataPath 设置存活代理的持久化文件，启动时加载、运行中定期保存，默认不持久化
+func WithAliveDataPath(path string) Option {
+	return func(p *Pool) error {
+		p.aliveDataPath = path
+		return nil
+	}
+}
+
+// WithProxies 添加启动时检测的代理 URL(socks5://user:pass@ip:port)
+func WithProxies(proxyURLs ...string) Option {
+	return func(p *Pool) error {
+		p.seeds = append(p.seeds, proxyURLs...)
+		return nil
+	}
+}
+
+// WithCheckURL 设置存活检测的 URL 与响应中必须包含的关键词
+func WithCheckURL(urls []string, keywords []string) Option {
+	return func(p *Pool) error {
+		p.config.CheckSock.CheckURL = urls
+		p.config.CheckSock.CheckRspKeywords = keywords
+		return nil
+	}
+}
+
+// WithMinSize 设置代理池的最小存活数量，低于该值时从代理源补充
+func WithMinSize(n int) Option {
+	return func(p *Pool) error {
+		p.config.CheckSock.MinSize = n
+		return nil
+	}
+}
+
+// WithConcurrency 设置后台检测的并发范围，min 等于 max 时关闭自适应并发
+func WithConcurrency(min, max int) Option {
+	return func(p *Pool) error {
+		p.config.CheckSock.MinConcurrentReq = min
+		p.config.CheckSock.MaxConcurrentReq = max
+		p.config.CheckSock.Adaptive = min != max
+		return nil
+	}
+}
+
+// WithMaxLatency 设置代理池可接受的最大延迟
+func WithMaxLatency(d time.Duration) Option {
+	return func(p *Pool) error {
+		p.config.CheckSock.MaxLatency = int(d / time.Millisecond)
+		return nil
+	}
+}
+
+// WithTimeouts 设置检测与实时拨号使用的超时，传 nil 表示保持默认
+func WithTimeouts(check, dial *types.Timeouts) Option {
+	return func(p *Pool) error {
+		if check != nil {
+			p.config.CheckSock.Timeouts = check
+		}
+		if dial != nil {
+			p.config.Listener.Timeouts = dial
+		}
+		return nil
+	}
+}
+
+// WithGeolocate 设置地理位置检测，传 nil 表示关闭
+func WithGeolocate(geo *types.CheckGeolocate) Option {
+	return func(p *Pool) error {
+		if geo == nil {
+			geo = &types.CheckGeolocate{}
+		}
+		p.config.CheckGeolocate = geo
+		return nil
+	}
+}
+
+// WithSources 替换全部代理源配置，默认不启用任何代理源
+func WithSources(sources *types.SourcesConfig) Option {
+	return func(p *Pool) error {
+		p.config.SourcesConfig = sources
+		return nil
+	}
+}
@@ -0,0 +1,266 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DNS 服务器的传输方式
+const (
+	kindUDP   = "udp"
+	kindTCP   = "tcp"
+	kindTLS   = "tls"   // DNS over TLS
+	kindHTTPS = "https" // DNS over HTTPS
+)
+
+// queryTypes 依次查询的记录类型
+var queryTypes = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+
+// maxMessageSize DNS 消息的最大长度
+const maxMessageSize = 65535
+
+// server 一个 DNS 服务器
+type server struct {
+	raw        string
+	kind       string
+	addr       string // udp/tcp/tls 的 host:port
+	serverName string // tls 校验证书使用的名称
+	url        string // https 的查询地址
+}
+
+// exchange 查询一种记录，返回得到的地址与最小的 TTL
+// dial 不为 nil 时经由 dial 建立连接，经由代理时 UDP 服务器改用 TCP 查询
+func (s *server) exchange(ctx context.Context, name string, qtype dnsmessage.Type, dial DialFunc, client *dohClient) ([]net.IP, time.Duration, error) {
+	id := uint16(rand.Uint32())
+	query, err := buildQuery(id, name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp []byte
+	switch s.kind {
+	case kindHTTPS:
+		// RFC 8484 建议 DoH 查询使用 0 作为 ID，便于缓存
+		binary.BigEndian.PutUint16(query, 0)
+		id = 0
+		resp, err = client.do(ctx, s.url, query)
+	case kindUDP:
+		if dial != nil {
+			resp, err = s.stream(ctx, dial, query, false)
+			break
+		}
+		resp, err = s.packet(ctx, query)
+		if err == nil && truncated(resp) {
+			resp, err = s.stream(ctx, nil, query, false)
+		}
+	case kindTCP:
+		resp, err = s.stream(ctx, dial, query, false)
+	case kindTLS:
+		resp, err = s.stream(ctx, dial, query, true)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return parseResponse(resp, id)
+}
+
+// packet 通过 UDP 查询
+func (s *server) packet(ctx context.Context, query []byte) ([]byte, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// 忽略 ID 不匹配的应答，防止伪造
+		if n >= 2 && bytes.Equal(buf[:2], query[:2]) {
+			return buf[:n], nil
+		}
+	}
+}
+
+// stream 通过 TCP 或 TLS 查询，消息前带两字节的长度
+func (s *server) stream(ctx context.Context, dial DialFunc, query []byte, useTLS bool) ([]byte, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: s.serverName})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dohClient DNS over HTTPS 客户端
+type dohClient struct {
+	http *http.Client
+}
+
+// newDoHClient 创建 DoH 客户端，dial 为 nil 时直接连接
+func newDoHClient(dial DialFunc, timeout time.Duration) *dohClient {
+	transport := &http.Transport{
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if dial != nil {
+		transport.DialContext = dial
+	} else {
+		transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return &dohClient{http: &http.Client{Transport: transport, Timeout: timeout}}
+}
+
+func (c *dohClient) do(ctx context.Context, url string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+}
+
+// close 关闭空闲连接，经由代理的客户端用完后调用
+func (c *dohClient) close() {
+	c.http.CloseIdleConnections()
+}
+
+func buildQuery(id uint16, name string, qtype dnsmessage.Type) ([]byte, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %v", name, err)
+	}
+	b := dnsmessage.NewBuilder(make([]byte, 2, 512), dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return msg[2:], nil
+}
+
+// truncated 判断 UDP 应答是否被截断
+func truncated(resp []byte) bool {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	return err == nil && h.Truncated
+}
+
+// parseResponse 从应答中取出 A 与 AAAA 记录，CNAME 指向的记录由服务器一并返回
+func parseResponse(resp []byte, id uint16) ([]net.IP, time.Duration, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid dns response: %v", err)
+	}
+	if !h.Response || h.ID != id {
+		return nil, 0, errors.New("invalid dns response: id mismatch")
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, errors.New("no such host")
+	default:
+		return nil, 0, fmt.Errorf("dns server returned %s", h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, fmt.Errorf("invalid dns response: %v", err)
+	}
+
+	var ips []net.IP
+	var ttl time.Duration
+	for {
+		rh, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid dns response: %v", err)
+		}
+		switch rh.Type {
+		case dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid dns response: %v", err)
+			}
+			ips = append(ips, net.IP(a.A[:]))
+		case dnsmessage.TypeAAAA:
+			aaaa, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid dns response: %v", err)
+			}
+			ips = append(ips, net.IP(aaaa.AAAA[:]))
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, fmt.Errorf("invalid dns response: %v", err)
+			}
+			continue
+		}
+		if d := time.Duration(rh.TTL) * time.Second; ttl == 0 || d < ttl {
+			ttl = d
+		}
+	}
+	return ips, ttl, nil
+}
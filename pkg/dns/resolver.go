@@ -0,0 +1,263 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 域名的解析方式
+const (
+	ModeRemote = "remote" // 把域名交给上游代理解析
+	ModeLocal  = "local"  // 本地解析，使用配置的 DNS 服务器，未配置时使用系统的解析器
+	ModeProxy  = "proxy"  // 经选中的代理向 DNS 服务器查询，得到与出口所在地区一致的结果
+)
+
+// defaultTimeout 单次查询的默认超时
+const defaultTimeout = 5 * time.Second
+
+// defaultProxyServers proxy 模式未配置 DNS 服务器时使用的服务器
+var defaultProxyServers = []string{"tcp://8.8.8.8:53", "tcp://1.1.1.1:53"}
+
+// DialFunc 建立到 DNS 服务器的连接，proxy 模式下经由代理
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Resolver 按配置的方式解析域名，nil 等同于使用系统解析器的 local 模式
+type Resolver struct {
+	mode    string
+	servers []*server
+	timeout time.Duration
+	client  *dohClient // 本地直连的 DoH 客户端，复用连接
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry // 本地解析的结果，经代理的查询结果与出口相关，不缓存
+}
+
+type cacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// maxCacheEntries 本地解析缓存的最大条目数，超过后清空
+const maxCacheEntries = 4096
+
+// maxCacheTTL 缓存的最长时间，DNS 记录的 TTL 更短时以 TTL 为准
+const maxCacheTTL = time.Minute
+
+// New 根据配置创建解析器，cfg 为 nil 时返回 nil
+func New(cfg *types.DNS) (*Resolver, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	r := &Resolver{
+		mode:    strings.ToLower(cfg.Mode),
+		timeout: defaultTimeout,
+		cache:   make(map[string]*cacheEntry),
+	}
+	if r.mode == "" {
+		r.mode = ModeLocal
+	}
+	switch r.mode {
+	case ModeRemote, ModeLocal, ModeProxy:
+	default:
+		return nil, fmt.Errorf("unknown dns mode %q, expected remote, local or proxy", cfg.Mode)
+	}
+	if cfg.Timeout > 0 {
+		r.timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	servers := cfg.Servers
+	if r.mode == ModeProxy && len(servers) == 0 {
+		servers = defaultProxyServers
+	}
+	for _, s := range servers {
+		srv, err := parseServer(s)
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, srv)
+	}
+	r.client = newDoHClient(nil, r.timeout)
+	return r, nil
+}
+
+// Validate 校验解析配置
+func Validate(cfg *types.DNS) error {
+	_, err := New(cfg)
+	return err
+}
+
+// Mode 返回解析方式
+func (r *Resolver) Mode() string {
+	if r == nil {
+		return ModeLocal
+	}
+	return r.mode
+}
+
+// LookupIP 解析域名，IPv4 地址排在前面；dial 不为 nil 时经由 dial 连接 DNS 服务器，用于 proxy 模式
+func (r *Resolver) LookupIP(ctx context.Context, host string, dial DialFunc) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if r == nil || (len(r.servers) == 0 && dial == nil) {
+		timeout := defaultTimeout
+		if r != nil {
+			timeout = r.timeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		return sortIPs(ips), nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if dial == nil {
+		if ips, ok := r.cached(name); ok {
+			return ips, nil
+		}
+	}
+	var lastErr error
+	for _, srv := range r.servers {
+		ips, ttl, err := r.query(ctx, srv, name, dial)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %v", srv.raw, err)
+			continue
+		}
+		if dial == nil {
+			r.store(name, ips, ttl)
+		}
+		return ips, nil
+	}
+	return nil, fmt.Errorf("failed to resolve %s: %v", host, lastErr)
+}
+
+// query 向单个服务器查询 A 与 AAAA 记录
+func (r *Resolver) query(ctx context.Context, srv *server, name string, dial DialFunc) ([]net.IP, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	client := r.client
+	if dial != nil && srv.kind == kindHTTPS {
+		client = newDoHClient(dial, r.timeout)
+		defer client.close()
+	}
+	var ips []net.IP
+	ttl := maxCacheTTL
+	var lastErr error
+	for _, qtype := range queryTypes {
+		answers, answerTTL, err := srv.exchange(ctx, name, qtype, dial, client)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, answers...)
+		if len(answers) > 0 && answerTTL < ttl {
+			ttl = answerTTL
+		}
+	}
+	if len(ips) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no such host")
+		}
+		return nil, 0, lastErr
+	}
+	return ips, ttl, nil
+}
+
+func (r *Resolver) cached(name string) ([]net.IP, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.cache[name]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.ips, true
+}
+
+func (r *Resolver) store(name string, ips []net.IP, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= maxCacheEntries {
+		r.cache = make(map[string]*cacheEntry)
+	}
+	r.cache[name] = &cacheEntry{ips: ips, expires: time.Now().Add(ttl)}
+}
+
+// sortIPs 把 IPv4 地址排在 IPv6 地址前面，上游代理普遍不支持 IPv6
+func sortIPs(ips []net.IP) []net.IP {
+	sorted := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			sorted = append(sorted, ip)
+		}
+	}
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			sorted = append(sorted, ip)
+		}
+	}
+	return sorted
+}
+
+// ResolveAddr 按解析方式处理 host:port 形式的地址：remote 模式原样返回，其余模式把域名替换为解析得到的第一个 IP
+// proxy 模式经由 dial 查询
+func (r *Resolver) ResolveAddr(ctx context.Context, addr string, dial DialFunc) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	switch r.Mode() {
+	case ModeRemote:
+		return addr, nil
+	case ModeLocal:
+		dial = nil
+	}
+	ips, err := r.LookupIP(ctx, host, dial)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// parseServer 解析 DNS 服务器地址：8.8.8.8、udp://8.8.8.8:53、tcp://8.8.8.8:53、tls://1.1.1.1:853、https://1.1.1.1/dns-query
+func parseServer(raw string) (*server, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "udp://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid dns server %q", raw)
+	}
+	srv := &server{raw: raw, kind: strings.ToLower(u.Scheme)}
+	switch srv.kind {
+	case kindUDP, kindTCP:
+		srv.addr = withPort(u.Host, "53")
+	case kindTLS:
+		srv.addr = withPort(u.Host, "853")
+		srv.serverName = u.Hostname()
+	case kindHTTPS:
+		srv.url = u.String()
+	default:
+		return nil, fmt.Errorf("invalid dns server %q, expected udp, tcp, tls or https", raw)
+	}
+	return srv, nil
+}
+
+func withPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
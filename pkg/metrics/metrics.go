@@ -0,0 +1,221 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 标签取值都来自有限的集合(检测阶段、结果、代理源、监听地址、国家)，不使用代理地址等无界取值作为标签
+
+// 检测与拨号结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultTimeout = "timeout"
+)
+
+var (
+	// Registry deadpool 的指标注册表，包含 Go 运行时与进程指标
+	Registry = prometheus.NewRegistry()
+
+	checks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "checks_total",
+		Help:      "Proxy checks by stage (precheck, geolocate, alive) and result.",
+	}, []string{"stage", "result"})
+
+	checkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "deadpool",
+		Name:      "check_duration_seconds",
+		Help:      "Duration of proxy checks by stage.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 11),
+	}, []string{"stage"})
+
+	sourceFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "source_fetches_total",
+		Help:      "Source fetches by source and result.",
+	}, []string{"source", "result"})
+
+	sourceProxies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "source_proxies_total",
+		Help:      "Proxies yielded by sources: fetched from the source, accepted into the pool after checks.",
+	}, []string{"source", "state"})
+
+	dials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "dials_total",
+		Help:      "Upstream dials by listener and result.",
+	}, []string{"listener", "result"})
+
+	dialDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "deadpool",
+		Name:      "dial_duration_seconds",
+		Help:      "Duration of upstream dials by listener and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 11),
+	}, []string{"listener", "result"})
+
+	activeTunnels = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deadpool",
+		Name:      "active_tunnels",
+		Help:      "Currently open tunnels by listener.",
+	}, []string{"listener"})
+
+	bytesRelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "relayed_bytes_total",
+		Help:      "Bytes relayed through tunnels by listener and direction (upload, download).",
+	}, []string{"listener", "direction"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "auth_failures_total",
+		Help:      "Failed SOCKS5 authentications by listener.",
+	}, []string{"listener"})
+
+	clientRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deadpool",
+		Name:      "client_rejections_total",
+		Help:      "Client connections rejected before the handshake by listener and reason (deny, not_allowed).",
+	}, []string{"listener", "reason"})
+
+	poolProxiesDesc = prometheus.NewDesc("deadpool_pool_proxies",
+		"Proxies in the pool by state (alive, dead, disabled), source and country.",
+		[]string{"state", "source", "country"}, nil)
+
+	sourceHealthDesc = prometheus.NewDesc("deadpool_source_health",
+		"Source health: 1 for the current state (healthy, degraded, failing), 0 otherwise.",
+		[]string{"source", "state"}, nil)
+
+	sourceFailuresDesc = prometheus.NewDesc("deadpool_source_consecutive_failures",
+		"Consecutive failed fetches of a source.",
+		[]string{"source"}, nil)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		checks, checkDuration,
+		sourceFetches, sourceProxies,
+		dials, dialDuration, activeTunnels, bytesRelayed, authFailures, clientRejections,
+		pool, sourceHealth,
+	)
+}
+
+// Handler 返回 /metrics 的处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Result 根据错误得到结果标签
+func Result(ok bool, err error) string {
+	if ok {
+		return ResultSuccess
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ResultTimeout
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return ResultTimeout
+		}
+	}
+	return ResultFailure
+}
+
+// ObserveCheck 记录一次检测的结果与耗时
+func ObserveCheck(stage string, start time.Time, ok bool, err error) {
+	checks.WithLabelValues(stage, Result(ok, err)).Inc()
+	checkDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSourceFetch 记录一次代理源获取
+func ObserveSourceFetch(source string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	sourceFetches.WithLabelValues(source, result).Inc()
+}
+
+// SourceFetched 记录代理源获取到一个代理
+func SourceFetched(source string) {
+	sourceProxies.WithLabelValues(source, "fetched").Inc()
+}
+
+// SourceAccepted 记录代理源的一个代理通过检测加入代理池
+func SourceAccepted(source string) {
+	sourceProxies.WithLabelValues(source, "accepted").Inc()
+}
+
+// ObserveDial 记录一次上游拨号的结果与耗时
+func ObserveDial(listener string, start time.Time, err error) {
+	result := Result(err == nil, err)
+	dials.WithLabelValues(listener, result).Inc()
+	dialDuration.WithLabelValues(listener, result).Observe(time.Since(start).Seconds())
+}
+
+// AuthFailed 记录一次认证失败
+func AuthFailed(listener string) {
+	authFailures.WithLabelValues(listener).Inc()
+}
+
+// ClientRejected 记录一次在握手前被拒绝的客户端连接
+func ClientRejected(listener, reason string) {
+	clientRejections.WithLabelValues(listener, reason).Inc()
+}
+
+// TrackTunnel 包装上游连接：关闭前计入活跃隧道，并统计经过的字节数
+func TrackTunnel(listener string, conn net.Conn) net.Conn {
+	activeTunnels.WithLabelValues(listener).Inc()
+	return &tunnelConn{
+		Conn:     conn,
+		active:   activeTunnels.WithLabelValues(listener),
+		upload:   bytesRelayed.WithLabelValues(listener, "upload"),
+		download: bytesRelayed.WithLabelValues(listener, "download"),
+	}
+}
+
+// tunnelConn 统计字节数的上游连接，写入为上行(客户端 -> 目标)，读取为下行
+type tunnelConn struct {
+	net.Conn
+	active   prometheus.Gauge
+	upload   prometheus.Counter
+	download prometheus.Counter
+	once     sync.Once
+}
+
+func (c *tunnelConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.download.Add(float64(n))
+	return n, err
+}
+
+func (c *tunnelConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.upload.Add(float64(n))
+	return n, err
+}
+
+// CloseWrite 转发半关闭，客户端发送完毕后通知上游
+func (c *tunnelConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *tunnelConn) Close() error {
+	c.once.Do(c.active.Dec)
+	return c.Conn.Close()
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+// PoolGroup 代理池中状态、来源与国家都相同的一组代理的数量
+type PoolGroup struct {
+	State   string // alive / dead / disabled
+	Source  string
+	Country string
+	Count   int
+}
+
+// poolCollector 抓取时实时统计代理池，避免在每次状态变化时维护 gauge
+type poolCollector struct {
+	mu sync.RWMutex
+	fn func() []PoolGroup
+}
+
+var pool = &poolCollector{}
+
+// SetPoolFunc 设置统计代理池的函数，通常为 SocksProxyManager.PoolGroups
+func SetPoolFunc(fn func() []PoolGroup) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.fn = fn
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolProxiesDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	fn := c.fn
+	c.mu.RUnlock()
+	if fn == nil {
+		return
+	}
+	for _, g := range fn() {
+		ch <- prometheus.MustNewConstMetric(poolProxiesDesc, prometheus.GaugeValue, float64(g.Count), g.State, g.Source, g.Country)
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+// SourceHealth 一个代理源的健康状态
+type SourceHealth struct {
+	Source              string
+	Health              string // healthy / degraded / failing
+	ConsecutiveFailures int
+}
+
+// sourceHealths 代理源所有可能的健康状态，当前状态为 1，其余为 0
+var sourceHealths = []string{"healthy", "degraded", "failing"}
+
+// sourceCollector 抓取时读取代理源的健康状态
+type sourceCollector struct {
+	mu sync.RWMutex
+	fn func() []SourceHealth
+}
+
+var sourceHealth = &sourceCollector{}
+
+// SetSourceFunc 设置读取代理源健康状态的函数，通常为 SocksProxyManager.SourceHealths
+func SetSourceFunc(fn func() []SourceHealth) {
+	sourceHealth.mu.Lock()
+	defer sourceHealth.mu.Unlock()
+	sourceHealth.fn = fn
+}
+
+func (c *sourceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sourceHealthDesc
+	ch <- sourceFailuresDesc
+}
+
+func (c *sourceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	fn := c.fn
+	c.mu.RUnlock()
+	if fn == nil {
+		return
+	}
+	for _, s := range fn() {
+		for _, h := range sourceHealths {
+			v := 0.0
+			if s.Health == h {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(sourceHealthDesc, prometheus.GaugeValue, v, s.Source, h)
+		}
+		ch <- prometheus.MustNewConstMetric(sourceFailuresDesc, prometheus.GaugeValue, float64(s.ConsecutiveFailures), s.Source)
+	}
+}
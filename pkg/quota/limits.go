@@ -0,0 +1,94 @@
+package quota
+
+import (
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/acl"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"strconv"
+	"strings"
+)
+
+// byteUnits 流量单位，按 1024 进制换算
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TIB", 1 << 40}, {"TB", 1 << 40}, {"T", 1 << 40},
+	{"GIB", 1 << 30}, {"GB", 1 << 30}, {"G", 1 << 30},
+	{"MIB", 1 << 20}, {"MB", 1 << 20}, {"M", 1 << 20},
+	{"KIB", 1 << 10}, {"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize 解析流量大小，如 1024、500MB、10GB，空字符串返回 0
+func ParseByteSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// limits 解析后的用户配额
+type limits struct {
+	maxConns int
+	rps      float64
+	perDay   int64
+	perMonth int64
+	ports    []acl.PortRange // 为空表示不限制
+}
+
+func (l *limits) allowPort(port int) bool {
+	if len(l.ports) == 0 {
+		return true
+	}
+	for _, r := range l.ports {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLimits 解析所有用户的配额
+func parseLimits(quotas map[string]*types.Quota) (map[string]*limits, error) {
+	parsed := make(map[string]*limits, len(quotas))
+	for user, q := range quotas {
+		if q == nil {
+			continue
+		}
+		if q.MaxConns < 0 || q.RequestsPerSecond < 0 {
+			return nil, fmt.Errorf("quota %s: maxConns and requestsPerSecond must not be negative", user)
+		}
+		l := &limits{maxConns: q.MaxConns, rps: q.RequestsPerSecond}
+		var err error
+		if l.perDay, err = ParseByteSize(q.BytesPerDay); err != nil {
+			return nil, fmt.Errorf("quota %s: bytesPerDay: %v", user, err)
+		}
+		if l.perMonth, err = ParseByteSize(q.BytesPerMonth); err != nil {
+			return nil, fmt.Errorf("quota %s: bytesPerMonth: %v", user, err)
+		}
+		if l.ports, err = acl.ParsePortRanges(q.AllowedPorts); err != nil {
+			return nil, fmt.Errorf("quota %s: allowedPorts: %v", user, err)
+		}
+		parsed[user] = l
+	}
+	return parsed, nil
+}
+
+// Validate 校验配额配置
+func Validate(quotas map[string]*types.Quota) error {
+	_, err := parseLimits(quotas)
+	return err
+}
@@ -0,0 +1,350 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPortNotAllowed 目标端口不在允许的范围内
+	ErrPortNotAllowed = errors.New("destination port not allowed")
+	// ErrTooManyConns 并发连接数已达上限
+	ErrTooManyConns = errors.New("too many concurrent connections")
+	// ErrRateLimited 新建连接过于频繁
+	ErrRateLimited = errors.New("request rate exceeded")
+	// ErrDailyQuota 当天的流量已用完
+	ErrDailyQuota = errors.New("daily traffic quota exceeded")
+	// ErrMonthlyQuota 当月的流量已用完
+	ErrMonthlyQuota = errors.New("monthly traffic quota exceeded")
+)
+
+// DefaultUser 配额中作用于没有单独配置的用户的键
+const DefaultUser = "*"
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// counter 持久化的流量计数，日期按本地时间切换
+type counter struct {
+	Day        string `json:"day"`
+	DayBytes   int64  `json:"day_bytes"`
+	Month      string `json:"month"`
+	MonthBytes int64  `json:"month_bytes"`
+}
+
+// roll 日期或月份变化时清零对应的计数
+func (c *counter) roll(now time.Time) {
+	if day := now.Format(dayLayout); c.Day != day {
+		c.Day, c.DayBytes = day, 0
+	}
+	if month := now.Format(monthLayout); c.Month != month {
+		c.Month, c.MonthBytes = month, 0
+	}
+}
+
+// user 单个用户的用量
+type user struct {
+	counter
+	conns  int
+	tokens float64   // 令牌桶中剩余的令牌，用于限制每秒新建的连接数
+	refill time.Time // 上次补充令牌的时间
+}
+
+// Usage 用户的当前用量与配额，配额为 0 表示不限制
+type Usage struct {
+	User              string  `json:"user"`
+	Conns             int     `json:"conns"`
+	DayBytes          int64   `json:"day_bytes"`
+	MonthBytes        int64   `json:"month_bytes"`
+	MaxConns          int     `json:"max_conns"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	BytesPerDay       int64   `json:"bytes_per_day"`
+	BytesPerMonth     int64   `json:"bytes_per_month"`
+}
+
+// Manager 按认证用户统计用量并检查配额，流量计数保存到文件，重启后继续累计
+type Manager struct {
+	path string
+
+	mu        sync.Mutex
+	limits    map[string]*limits // listener.quotas 中的配额
+	overrides map[string]*limits // 用户文件中的配额，优先于 limits
+	users     map[string]*user
+	dirty     bool // 流量计数有未保存的变化
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New 创建配额管理器并从 path 加载已保存的流量计数，path 为空时不持久化
+func New(path string, quotas map[string]*types.Quota) (*Manager, error) {
+	parsed, err := parseLimits(quotas)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{path: path, limits: parsed, users: make(map[string]*user)}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SetQuotas 热加载配额，已建立的连接之后传输的流量按新配额检查
+func (m *Manager) SetQuotas(quotas map[string]*types.Quota) error {
+	commit, err := m.PrepareQuotas(quotas)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// PrepareQuotas 解析 listener.quotas 中的配额，返回的 commit 调用后新配额才生效，出错时当前配额不受影响
+func (m *Manager) PrepareQuotas(quotas map[string]*types.Quota) (commit func(), err error) {
+	parsed, err := parseLimits(quotas)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		m.mu.Lock()
+		m.limits = parsed
+		m.mu.Unlock()
+	}, nil
+}
+
+// SetUserQuotas 设置用户文件中的配额，优先于 listener.quotas 中的配置
+func (m *Manager) SetUserQuotas(quotas map[string]*types.Quota) error {
+	parsed, err := parseLimits(quotas)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.overrides = parsed
+	m.mu.Unlock()
+	return nil
+}
+
+// limitsFor 返回用户的配额，依次查找用户文件、listener.quotas 与默认配额，都没有时返回 nil
+func (m *Manager) limitsFor(name string) *limits {
+	if l, ok := m.overrides[name]; ok {
+		return l
+	}
+	if l, ok := m.limits[name]; ok {
+		return l
+	}
+	return m.limits[DefaultUser]
+}
+
+// userFor 返回用户的用量，不存在时创建
+func (m *Manager) userFor(name string, now time.Time) *user {
+	u, ok := m.users[name]
+	if !ok {
+		u = &user{}
+		m.users[name] = u
+	}
+	u.roll(now)
+	return u
+}
+
+// Acquire 检查用户能否向目标端口建立新连接，通过时占用一个连接，连接结束后需要调用 Lease.Release
+func (m *Manager) Acquire(name string, port int) (*Lease, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userFor(name, now)
+	if l := m.limitsFor(name); l != nil {
+		switch {
+		case !l.allowPort(port):
+			return nil, ErrPortNotAllowed
+		case l.maxConns > 0 && u.conns >= l.maxConns:
+			return nil, ErrTooManyConns
+		case l.perDay > 0 && u.DayBytes >= l.perDay:
+			return nil, ErrDailyQuota
+		case l.perMonth > 0 && u.MonthBytes >= l.perMonth:
+			return nil, ErrMonthlyQuota
+		}
+		if l.rps > 0 && !u.take(l.rps, now) {
+			return nil, ErrRateLimited
+		}
+	}
+	u.conns++
+	return &Lease{manager: m, user: name}, nil
+}
+
+// take 从令牌桶中取出一个令牌，桶容量为每秒的速率(至少为 1)
+func (u *user) take(rps float64, now time.Time) bool {
+	burst := max(rps, 1)
+	if u.refill.IsZero() {
+		u.tokens = burst
+	} else {
+		u.tokens = min(burst, u.tokens+now.Sub(u.refill).Seconds()*rps)
+	}
+	u.refill = now
+	if u.tokens < 1 {
+		return false
+	}
+	u.tokens--
+	return true
+}
+
+// Usage 返回所有用户的当前用量，按用户名排序
+func (m *Manager) Usage() []Usage {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := make([]Usage, 0, len(m.users))
+	for name := range m.users {
+		u := m.userFor(name, now)
+		item := Usage{User: name, Conns: u.conns, DayBytes: u.DayBytes, MonthBytes: u.MonthBytes}
+		if l := m.limitsFor(name); l != nil {
+			item.MaxConns, item.RequestsPerSecond = l.maxConns, l.rps
+			item.BytesPerDay, item.BytesPerMonth = l.perDay, l.perMonth
+		}
+		usage = append(usage, item)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].User < usage[j].User })
+	return usage
+}
+
+// Run 启动定期保存流量计数，ctx 取消或调用 Close 后退出
+func (m *Manager) Run(ctx context.Context) {
+	if m.path == "" {
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	ticker := time.NewTicker(10 * time.Second)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = m.Save()
+			}
+		}
+	}()
+}
+
+// Close 停止定期保存并最后保存一次
+func (m *Manager) Close() error {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+	return m.Save()
+}
+
+// Save 把流量计数写入文件，没有变化时跳过
+func (m *Manager) Save() error {
+	if m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	if !m.dirty {
+		m.mu.Unlock()
+		return nil
+	}
+	counters := make(map[string]counter, len(m.users))
+	for name, u := range m.users {
+		counters[name] = u.counter
+	}
+	m.dirty = false
+	m.mu.Unlock()
+
+	data, err := json.MarshalIndent(counters, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	// 先写临时文件再重命名，避免写入中途退出导致文件损坏
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write quota usage: %v", err)
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// load 加载已保存的流量计数，文件不存在时忽略
+func (m *Manager) load() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota usage: %v", err)
+	}
+	var counters map[string]counter
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return fmt.Errorf("failed to parse quota usage: %v", err)
+	}
+	for name, c := range counters {
+		m.users[name] = &user{counter: c}
+	}
+	return nil
+}
+
+// Lease 一个连接占用的配额
+type Lease struct {
+	manager *Manager
+	user    string
+	once    sync.Once
+}
+
+// Add 记入连接传输的字节数，超出当天或当月的流量时返回错误，调用方应结束连接
+func (l *Lease) Add(n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	m := l.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userFor(l.user, time.Now())
+	u.DayBytes += int64(n)
+	u.MonthBytes += int64(n)
+	m.dirty = true
+	if lim := m.limitsFor(l.user); lim != nil {
+		if lim.perDay > 0 && u.DayBytes > lim.perDay {
+			return ErrDailyQuota
+		}
+		if lim.perMonth > 0 && u.MonthBytes > lim.perMonth {
+			return ErrMonthlyQuota
+		}
+	}
+	return nil
+}
+
+// Release 连接结束时释放占用的连接数，可以重复调用
+func (l *Lease) Release() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		l.manager.mu.Lock()
+		defer l.manager.mu.Unlock()
+		if u, ok := l.manager.users[l.user]; ok && u.conns > 0 {
+			u.conns--
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRejected 请求被 REJECT 规则拒绝
+var ErrRejected = errors.New("rejected by routing rule")
+
+// Upstreams 通过代理建立连接，通常为 SocksProxyManager
+type Upstreams interface {
+	// DialPool 通过命名代理池中的代理建立连接，pools 为空时使用整个代理池
+	DialPool(ctx context.Context, pools []string, network, addr string) (net.Conn, error)
+	// DialUpstream 通过指定的上游代理建立连接
+	DialUpstream(ctx context.Context, proxyURL, network, addr string) (net.Conn, error)
+}
+
+// PoolsFunc 返回用户允许使用的代理池，为空表示不限制
+type PoolsFunc func(user string) []string
+
+// Router 按规则为每个请求选择出口：直连、拒绝、整个代理池、命名代理池或固定的上游代理
+type Router struct {
+	upstreams Upstreams
+	state     atomic.Pointer[state]
+	pools     atomic.Pointer[PoolsFunc]
+}
+
+// state 一份路由配置，热加载时整体替换
+type state struct {
+	rules     []*rule
+	geoip     *maxminddb.Reader
+	geoipPath string
+	timeouts  *types.Timeouts
+	resolver  *dns.Resolver // 直连时解析目标域名，nil 表示使用系统的解析器
+}
+
+// New 创建路由，未调用 Apply 前所有请求都使用整个代理池
+func New(upstreams Upstreams) *Router {
+	r := &Router{upstreams: upstreams}
+	r.state.Store(&state{})
+	return r
+}
+
+// Validate 校验路由配置，不加载 GeoIP 数据库
+func Validate(cfg *types.ConfigOptions) error {
+	if cfg.Routing == nil {
+		return nil
+	}
+	if _, err := parseRules(cfg.Routing.Rules, cfg.Pools); err != nil {
+		return err
+	}
+	if needsGeoIP(cfg.Routing.Rules) && cfg.Routing.GeoIP == "" {
+		return errors.New("GEOIP rules require routing.geoip")
+	}
+	return nil
+}
+
+// Apply 应用路由配置，GeoIP 数据库路径未变化时沿用已加载的数据库
+func (r *Router) Apply(cfg *types.ConfigOptions) error {
+	commit, err := r.Prepare(cfg)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// Prepare 校验路由配置并加载 GeoIP 数据库，返回的 commit 调用后新配置才生效，出错时当前配置不受影响
+func (r *Router) Prepare(cfg *types.ConfigOptions) (commit func(), err error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	next := &state{timeouts: cfg.Listener.Timeouts}
+	next.resolver, _ = dns.New(cfg.Listener.DNS)
+	commit = func() { r.state.Store(next) }
+	if cfg.Routing == nil {
+		return commit, nil
+	}
+	next.rules, _ = parseRules(cfg.Routing.Rules, cfg.Pools)
+
+	current := r.state.Load()
+	if path := cfg.Routing.GeoIP; path != "" && needsGeoIP(cfg.Routing.Rules) {
+		if path == current.geoipPath && current.geoip != nil {
+			next.geoip, next.geoipPath = current.geoip, path
+		} else {
+			// 读入内存而不是 mmap，替换后旧的数据库由 GC 回收，不影响正在进行的查询
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read GeoIP database: %v", err)
+			}
+			reader, err := maxminddb.FromBytes(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse GeoIP database: %v", err)
+			}
+			next.geoip, next.geoipPath = reader, path
+		}
+	}
+	return commit, nil
+}
+
+// SetPools 设置用户允许使用的代理池，路由到代理池时只使用其中的代理池
+func (r *Router) SetPools(fn PoolsFunc) {
+	r.pools.Store(&fn)
+}
+
+// DialContext 按规则选择出口后建立连接
+func (r *Router) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	st := r.state.Load()
+	req := st.request(ctx, addr)
+	t, index := st.route(req)
+	if index > 0 {
+		gologger.Debug().Msgf("路由 %s -> %s (规则 %d: %s)", addr, t, index, st.rules[index-1].raw)
+	}
+
+	switch t.kind {
+	case TargetReject:
+		return nil, fmt.Errorf("%w %d", ErrRejected, index)
+	case TargetDirect:
+		if info := types.DialInfoFromContext(ctx); info != nil {
+			info.Upstream = TargetDirect
+		}
+		target, err := st.resolveDirect(ctx, req, addr)
+		if err != nil {
+			return nil, err
+		}
+		// 域名在这里才解析时，监听只按域名检查过目标地址，连接前再按解析得到的 IP 检查一次
+		if info := types.RequestFromContext(ctx); info != nil && info.CheckDirect != nil {
+			host, _, _ := net.SplitHostPort(target)
+			if err := info.CheckDirect(net.ParseIP(host)); err != nil {
+				return nil, err
+			}
+		}
+		dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+		if st.timeouts != nil && st.timeouts.Connect > 0 {
+			dialer.Timeout = time.Duration(st.timeouts.Connect) * time.Second
+		}
+		return dialer.DialContext(ctx, network, target)
+	case TargetUpstream:
+		return r.upstreams.DialUpstream(ctx, t.url, network, addr)
+	}
+
+	pools, err := r.allowedPools(req.user, t.pool)
+	if err != nil {
+		return nil, err
+	}
+	return r.upstreams.DialPool(ctx, pools, network, addr)
+}
+
+// allowedPools 结合用户允许使用的代理池得到实际使用的代理池
+func (r *Router) allowedPools(user, pool string) ([]string, error) {
+	var allowed []string
+	if fn := r.pools.Load(); fn != nil && user != "" {
+		allowed = (*fn)(user)
+	}
+	if pool == "" {
+		return allowed, nil
+	}
+	if len(allowed) == 0 {
+		return []string{pool}, nil
+	}
+	for _, p := range allowed {
+		if p == pool {
+			return []string{pool}, nil
+		}
+	}
+	return nil, fmt.Errorf("user %s is not allowed to use pool %s", user, pool)
+}
+
+// request 根据 ctx 中的请求信息与拨号地址得到参与匹配的请求
+func (st *state) request(ctx context.Context, addr string) *request {
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+	req := &request{port: port}
+	if info := types.RequestFromContext(ctx); info != nil {
+		req.user, req.fqdn = info.User, normalizeDomain(info.FQDN)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		req.ip = ip.Unmap()
+	} else {
+		if req.fqdn == "" {
+			req.fqdn = normalizeDomain(host)
+		}
+		// 监听在本地解析过的域名按解析得到的 IP 匹配 IP 规则
+		if info := types.RequestFromContext(ctx); info != nil && info.IP != nil && normalizeDomain(host) == req.fqdn {
+			if ip, ok := netip.AddrFromSlice(info.IP); ok {
+				req.ip = ip.Unmap()
+			}
+		}
+	}
+
+	if !req.ip.IsValid() && req.fqdn != "" {
+		var once sync.Once
+		var (
+			resolved netip.Addr
+			err      error
+		)
+		req.resolve = func() (netip.Addr, error) {
+			once.Do(func() {
+				var ips []net.IP
+				if ips, err = st.resolver.LookupIP(ctx, req.fqdn, nil); err != nil {
+					gologger.Debug().Msgf("路由时解析 %s 失败: %v", req.fqdn, err)
+					return
+				}
+				resolved, _ = netip.AddrFromSlice(ips[0])
+				resolved = resolved.Unmap()
+			})
+			return resolved, err
+		}
+	}
+
+	var once sync.Once
+	var country string
+	req.country = func() string {
+		once.Do(func() { country = st.lookupCountry(req.addr(true)) })
+		return country
+	}
+	return req
+}
+
+// resolveDirect 直连时解析目标域名，优先使用监听在本地解析或匹配规则时解析得到的 IP
+// 直连没有上游代理，remote 与 proxy 模式也在本地使用配置的 DNS 服务器解析
+func (st *state) resolveDirect(ctx context.Context, req *request, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	if req.ip.IsValid() {
+		return net.JoinHostPort(req.ip.String(), port), nil
+	}
+	if req.resolve != nil && normalizeDomain(host) == req.fqdn {
+		ip, err := req.resolve()
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(ip.String(), port), nil
+	}
+	ips, err := st.resolver.LookupIP(ctx, host, nil)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// route 返回第一条匹配的规则的出口与规则序号，都不匹配时返回整个代理池与 0
+func (st *state) route(req *request) (target, int) {
+	for _, r := range st.rules {
+		if r.match(req) {
+			return r.target, r.index
+		}
+	}
+	return target{kind: TargetPool}, 0
+}
+
+// lookupCountry 查询 IP 所在国家的 ISO 代码
+func (st *state) lookupCountry(ip netip.Addr) string {
+	if st.geoip == nil || !ip.IsValid() {
+		return ""
+	}
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := st.geoip.Lookup(net.IP(ip.AsSlice()), &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
@@ -0,0 +1,220 @@
+package router
+
+import (
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/acl"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// 规则的出口
+const (
+	TargetDirect   = "DIRECT"   // 不经过代理，直接连接目标
+	TargetReject   = "REJECT"   // 拒绝连接
+	TargetPool     = "POOL"     // 整个代理池，POOL:<name> 为命名代理池
+	TargetUpstream = "UPSTREAM" // UPSTREAM:<代理 URL> 为固定的上游代理
+)
+
+// target 规则的出口
+type target struct {
+	kind string // TargetDirect / TargetReject / TargetPool / TargetUpstream
+	pool string // 命名代理池，kind 为 TargetPool 时为空表示整个代理池
+	url  string // 上游代理 URL，kind 为 TargetUpstream 时使用
+}
+
+func (t target) String() string {
+	switch {
+	case t.kind == TargetPool && t.pool != "":
+		return TargetPool + ":" + t.pool
+	case t.kind == TargetUpstream:
+		return TargetUpstream
+	}
+	return t.kind
+}
+
+// request 参与规则匹配的请求信息
+type request struct {
+	user    string
+	fqdn    string     // 小写、去掉末尾的点，请求 IP 时为空
+	ip      netip.Addr // 目标 IP，只有域名且未解析时为零值
+	port    int
+	resolve func() (netip.Addr, error) // 解析域名，首次调用时查询
+	country func() string              // 目标 IP 所在国家，首次调用时查询，域名按解析得到的 IP 查询
+}
+
+// addr 返回参与 IP 规则匹配的目标 IP，只有域名时 resolve 为 true 才解析，解析失败返回零值
+func (req *request) addr(resolve bool) netip.Addr {
+	if req.ip.IsValid() || !resolve || req.resolve == nil {
+		return req.ip
+	}
+	ip, _ := req.resolve()
+	return ip
+}
+
+// rule 一条路由规则
+type rule struct {
+	index  int
+	raw    string
+	match  func(req *request) bool
+	target target
+}
+
+// parseRules 解析 TYPE,PAYLOAD,TARGET 形式的规则，MATCH 规则为 MATCH,TARGET
+// IP-CIDR、IP-CIDR6 与 GEOIP 规则遇到域名时先解析再匹配，末尾加上 no-resolve 时不解析，只匹配请求的 IP
+// pools 为已配置的命名代理池，用于检查规则引用的代理池是否存在
+func parseRules(lines []string, pools map[string]*types.Pool) ([]*rule, error) {
+	rules := make([]*rule, 0, len(lines))
+	for i, line := range lines {
+		r, err := parseRule(line, pools)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d %q: %v", i+1, line, err)
+		}
+		r.index = i + 1
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func parseRule(line string, pools map[string]*types.Pool) (*rule, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	kind := strings.ToUpper(fields[0])
+	if kind == "MATCH" {
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected MATCH,TARGET")
+		}
+		t, err := parseTarget(fields[1], pools)
+		if err != nil {
+			return nil, err
+		}
+		return &rule{raw: line, match: func(*request) bool { return true }, target: t}, nil
+	}
+	resolve := true
+	if len(fields) > 3 && isIPRule(kind) && strings.EqualFold(fields[len(fields)-1], "no-resolve") {
+		fields, resolve = fields[:len(fields)-1], false
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected TYPE,PAYLOAD,TARGET")
+	}
+	// 正则中可能包含逗号，首尾之外的部分都属于 payload
+	payload := strings.Join(fields[1:len(fields)-1], ",")
+	t, err := parseTarget(fields[len(fields)-1], pools)
+	if err != nil {
+		return nil, err
+	}
+	match, err := parseMatcher(kind, payload, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return &rule{raw: line, match: match, target: t}, nil
+}
+
+// isIPRule 判断规则是否按目标 IP 匹配
+func isIPRule(kind string) bool {
+	switch kind {
+	case "IP-CIDR", "IP-CIDR6", "GEOIP":
+		return true
+	}
+	return false
+}
+
+// parseMatcher 解析规则的匹配条件，resolve 为 false 时 IP 规则不解析域名
+func parseMatcher(kind, payload string, resolve bool) (func(req *request) bool, error) {
+	switch kind {
+	case "DOMAIN":
+		domain := normalizeDomain(payload)
+		return func(req *request) bool { return req.fqdn == domain }, nil
+	case "DOMAIN-SUFFIX":
+		suffix := normalizeDomain(payload)
+		return func(req *request) bool {
+			return req.fqdn == suffix || strings.HasSuffix(req.fqdn, "."+suffix)
+		}, nil
+	case "DOMAIN-KEYWORD":
+		keyword := strings.ToLower(payload)
+		return func(req *request) bool { return req.fqdn != "" && strings.Contains(req.fqdn, keyword) }, nil
+	case "DOMAIN-REGEX":
+		re, err := regexp.Compile(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %v", err)
+		}
+		return func(req *request) bool { return req.fqdn != "" && re.MatchString(req.fqdn) }, nil
+	case "IP-CIDR", "IP-CIDR6":
+		prefixes, err := acl.ParsePrefixes([]string{payload})
+		if err != nil {
+			return nil, err
+		}
+		return func(req *request) bool {
+			ip := req.addr(resolve)
+			return ip.IsValid() && prefixes[0].Contains(ip)
+		}, nil
+	case "DST-PORT":
+		ranges, err := acl.ParsePortRanges(strings.Split(payload, "/"))
+		if err != nil {
+			return nil, err
+		}
+		return func(req *request) bool {
+			for _, r := range ranges {
+				if r.Contains(req.port) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "GEOIP":
+		country := strings.ToUpper(payload)
+		if country == "PRIVATE" {
+			// 本机、私有网络与链路本地地址，不需要 GeoIP 数据库
+			return func(req *request) bool {
+				ip := req.addr(resolve)
+				return ip.IsValid() && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified())
+			}, nil
+		}
+		return func(req *request) bool { return req.addr(resolve).IsValid() && req.country() == country }, nil
+	case "USER":
+		return func(req *request) bool { return req.user == payload }, nil
+	}
+	return nil, fmt.Errorf("unknown rule type %q", kind)
+}
+
+func parseTarget(value string, pools map[string]*types.Pool) (target, error) {
+	kind, arg, _ := strings.Cut(value, ":")
+	switch strings.ToUpper(kind) {
+	case TargetDirect:
+		return target{kind: TargetDirect}, nil
+	case TargetReject:
+		return target{kind: TargetReject}, nil
+	case TargetPool:
+		if arg != "" {
+			if _, ok := pools[arg]; !ok {
+				return target{}, fmt.Errorf("pool %q is not configured", arg)
+			}
+		}
+		return target{kind: TargetPool, pool: arg}, nil
+	case TargetUpstream:
+		if !strings.Contains(arg, "://") {
+			return target{}, fmt.Errorf("UPSTREAM requires a proxy URL, like UPSTREAM:socks5://1.1.1.1:1080")
+		}
+		return target{kind: TargetUpstream, url: arg}, nil
+	}
+	return target{}, fmt.Errorf("unknown target %q, expected DIRECT, REJECT, POOL, POOL:<name> or UPSTREAM:<url>", value)
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// needsGeoIP 判断规则中是否有需要 GeoIP 数据库的 GEOIP 规则
+func needsGeoIP(lines []string) bool {
+	for _, line := range lines {
+		kind, payload, _ := strings.Cut(line, ",")
+		payload, _, _ = strings.Cut(payload, ",")
+		if strings.EqualFold(strings.TrimSpace(kind), "GEOIP") && !strings.EqualFold(strings.TrimSpace(payload), "PRIVATE") {
+			return true
+		}
+	}
+	return false
+}
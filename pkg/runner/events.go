@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"sync"
+	"time"
+)
+
+// recentConnEvents 保留的最近连接事件数，新订阅者会先收到这些事件
+const recentConnEvents = 100
+
+// ConnEvent 一次实时拨号的结果，即 DialContext 记录的 success/error 日志
+type ConnEvent struct {
+	Time    time.Time     `json:"time"`
+	Success bool          `json:"success"`
+	Proxy   string        `json:"proxy,omitempty"` // 上游代理 ip:port，不包含认证信息
+	Target  string        `json:"target"`          // 目标地址
+	ExitIP  string        `json:"exit_ip,omitempty"`
+	Latency time.Duration `json:"latency"` // 拨号耗时
+	Error   string        `json:"error,omitempty"`
+}
+
+// eventHub 连接事件的广播器，订阅者处理不过来时丢弃事件而不阻塞拨号
+type eventHub struct {
+	mu     sync.Mutex
+	recent []ConnEvent
+	next   int // recent 写满后下一个覆盖的位置
+	subs   map[chan ConnEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan ConnEvent]struct{})}
+}
+
+// publish 记录并广播事件
+func (h *eventHub) publish(e ConnEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.recent) < recentConnEvents {
+		h.recent = append(h.recent, e)
+	} else {
+		h.recent[h.next] = e
+		h.next = (h.next + 1) % recentConnEvents
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// snapshot 按时间顺序返回最近的事件
+func (h *eventHub) snapshot() []ConnEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := make([]ConnEvent, 0, len(h.recent))
+	events = append(events, h.recent[h.next:]...)
+	return append(events, h.recent[:h.next]...)
+}
+
+func (h *eventHub) subscribe() (<-chan ConnEvent, func()) {
+	ch := make(chan ConnEvent, 64)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// RecentConnEvents 按时间顺序返回最近的连接事件
+func (m *SocksProxyManager) RecentConnEvents() []ConnEvent {
+	return m.events.snapshot()
+}
+
+// SubscribeConnEvents 订阅之后的连接事件，使用完毕后调用返回的函数取消订阅
+func (m *SocksProxyManager) SubscribeConnEvents() (<-chan ConnEvent, func()) {
+	return m.events.subscribe()
+}
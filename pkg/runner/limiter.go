@@ -0,0 +1,169 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// checkLimiter 后台检测的自适应并发控制器(AIMD)
+// 超时比例低于阈值时每个统计窗口并发 +1，超过阈值时并发减半，始终限制在 [min, max] 之间。
+// 实时拨号(DialContext)不受限制，并且会占用后台检测的并发额度，保证实时流量优先。
+type checkLimiter struct {
+	mu       sync.Mutex
+	wake     chan struct{}
+	adaptive bool
+	min      int
+	max      int
+	limit    int
+	ratio    float64 // 超时比例阈值
+
+	inFlight int // 正在进行的后台检测数
+	live     int // 正在进行的实时拨号数
+	done     int // 当前窗口内完成的检测数
+	timeouts int // 当前窗口内超时的检测数
+}
+
+// newCheckLimiter 创建并发控制器，未启用自适应时并发固定为 max
+func newCheckLimiter(min, max int, adaptive bool, ratio float64) *checkLimiter {
+	if max <= 0 {
+		max = 1
+	}
+	if min <= 0 || min > max {
+		min = max
+	}
+	l := &checkLimiter{
+		wake:     make(chan struct{}),
+		adaptive: adaptive,
+		min:      min,
+		max:      max,
+		limit:    max,
+		ratio:    ratio,
+	}
+	if adaptive {
+		l.limit = (min + max) / 2
+	}
+	return l
+}
+
+// Acquire 获取一个后台检测额度，ctx 取消时返回错误
+func (l *checkLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.effectiveLimit() {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// Release 归还额度并上报本次检测是否超时，用于调整并发
+func (l *checkLimiter) Release(timedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if l.adaptive {
+		l.done++
+		if timedOut {
+			l.timeouts++
+		}
+		// 每个窗口(至少 10 次、不少于当前并发)评估一次超时比例
+		window := l.limit
+		if window < 10 {
+			window = 10
+		}
+		if l.done >= window {
+			if float64(l.timeouts)/float64(l.done) > l.ratio {
+				l.limit /= 2
+			} else {
+				l.limit++
+			}
+			if l.limit < l.min {
+				l.limit = l.min
+			}
+			if l.limit > l.max {
+				l.limit = l.max
+			}
+			l.done, l.timeouts = 0, 0
+		}
+	}
+	l.broadcast()
+}
+
+// SetBounds 热加载时更新并发范围与自适应策略，当前并发会被限制到新的范围内
+func (l *checkLimiter) SetBounds(min, max int, adaptive bool, ratio float64) {
+	n := newCheckLimiter(min, max, adaptive, ratio)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.min, l.max, l.adaptive, l.ratio = n.min, n.max, n.adaptive, n.ratio
+	if !l.adaptive {
+		l.limit = l.max
+	}
+	if l.limit < l.min {
+		l.limit = l.min
+	}
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+	l.done, l.timeouts = 0, 0
+	l.broadcast()
+}
+
+// LiveBegin 标记一次实时拨号开始，期间后台检测让出额度
+func (l *checkLimiter) LiveBegin() {
+	l.mu.Lock()
+	l.live++
+	l.mu.Unlock()
+}
+
+// LiveEnd 标记一次实时拨号结束
+func (l *checkLimiter) LiveEnd() {
+	l.mu.Lock()
+	l.live--
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// Limit 返回当前的后台检测并发上限
+func (l *checkLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *checkLimiter) effectiveLimit() int {
+	n := l.limit - l.live
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (l *checkLimiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// isTimeout 判断错误是否为超时
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
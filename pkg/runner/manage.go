@@ -0,0 +1,329 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"github.com/wjlin0/deadpool/pkg/metrics"
+	"github.com/wjlin0/deadpool/pkg/source"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrProxyNotFound 代理池中不存在指定的代理
+	ErrProxyNotFound = errors.New("proxy not found")
+	// ErrSourceNotFound 不存在指定名称的代理源
+	ErrSourceNotFound = errors.New("source not found")
+	// ErrPoolNotFound 不存在指定名称的代理池
+	ErrPoolNotFound = errors.New("pool not found")
+	// ErrManagerClosed 代理管理器已经关闭
+	ErrManagerClosed = errors.New("proxy manager closed")
+)
+
+// ProxyFilter 代理列表的筛选条件，零值字段表示不按该条件筛选
+type ProxyFilter struct {
+	Source     string        // 代理来源
+	Alive      *bool         // 是否存活
+	Country    string        // 出口所在国家，忽略大小写
+	MaxLatency time.Duration // 最大延迟
+}
+
+// match 判断代理是否符合筛选条件
+func (f ProxyFilter) match(p *ProxyInfo) bool {
+	if f.Source != "" && !strings.EqualFold(p.Source, f.Source) {
+		return false
+	}
+	if f.Alive != nil && p.IsAlive != *f.Alive {
+		return false
+	}
+	if f.Country != "" && !strings.EqualFold(p.Country, f.Country) {
+		return false
+	}
+	if f.MaxLatency > 0 && p.Latency > f.MaxLatency {
+		return false
+	}
+	return true
+}
+
+// poolContains 判断代理是否属于命名代理池
+func poolContains(pool *types.Pool, p *ProxyInfo) bool {
+	if len(pool.Sources) > 0 && !containsFold(pool.Sources, p.Source) {
+		return false
+	}
+	if len(pool.Countries) > 0 && !containsFold(pool.Countries, p.Country) {
+		return false
+	}
+	if pool.MaxLatency > 0 && p.Latency >= time.Duration(pool.MaxLatency)*time.Millisecond {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceStatus 代理源的运行状态
+type SourceStatus struct {
+	Name      string    `json:"name"`
+	Available bool      `json:"available"`        // Source.IsAvailable 的结果，退避期间为 false
+	Reason    string    `json:"reason,omitempty"` // 不可用的原因
+	LastFetch time.Time `json:"last_fetch"`       // 最近一次获取的时间，从未获取时为零值
+	Proxies   int       `json:"proxies"`          // 代理池中来自该源的代理数
+	Alive     int       `json:"alive"`            // 其中存活的代理数
+
+	source.Status // 健康状态、最近的错误与下次重试的时间
+
+	NextFetch    time.Time `json:"next_fetch"`    // 调度器计划的下一次获取，代理池充足时为零值
+	FetchPlan    string    `json:"fetch_plan"`    // 计划的原因，如 pool is full、waiting for fetch interval、backing off
+	LastFetched  int       `json:"last_fetched"`  // 最近一次获取到的候选代理数
+	LastAccepted int       `json:"last_accepted"` // 其中通过检测入池的代理数
+
+	types.Scheduling         // 配置的获取优先级与成本
+	Fetched          int     `json:"fetched"`  // 累计获取到的候选代理数
+	Accepted         int     `json:"accepted"` // 累计通过检测入池的代理数
+	Yield            float64 `json:"yield"`    // 累计入池比例，从未获取时为 -1
+
+	Credits *source.CreditState `json:"credits,omitempty"` // 搜索引擎数据源的积分用量与翻页进度
+}
+
+// creditReporter 记录积分用量的搜索引擎数据源
+type creditReporter interface {
+	CreditState() (source.CreditState, bool)
+}
+
+// PoolStats 代理池的整体统计
+type PoolStats struct {
+	Total      int `json:"total"`
+	Alive      int `json:"alive"`
+	Disabled   int `json:"disabled"`
+	Pinned     int `json:"pinned"`
+	CheckLimit int `json:"check_limit"` // 当前后台检测的并发上限
+	MinSize    int `json:"min_size"`    // 存活数量低于该值时从代理源补充
+	Target     int `json:"target"`      // 补充的目标数量 minSize + headroom
+}
+
+// Proxies 返回符合筛选条件的代理副本，按存活优先、延迟从低到高排序
+func (m *SocksProxyManager) Proxies(filter ProxyFilter) []*ProxyInfo {
+	m.mu.RLock()
+	proxies := make([]*ProxyInfo, 0, len(m.proxyMap))
+	for _, p := range m.proxyMap {
+		if filter.match(p) {
+			c := *p
+			proxies = append(proxies, &c)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(proxies, func(i, j int) bool {
+		if proxies[i].IsAlive != proxies[j].IsAlive {
+			return proxies[i].IsAlive
+		}
+		if proxies[i].Latency != proxies[j].Latency {
+			return proxies[i].Latency < proxies[j].Latency
+		}
+		return proxies[i].URL < proxies[j].URL
+	})
+	return proxies
+}
+
+// Proxy 返回指定代理的副本
+func (m *SocksProxyManager) Proxy(proxyURL string) (*ProxyInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.proxyMap[proxyURL]
+	if !ok {
+		return nil, false
+	}
+	c := *p
+	return &c, true
+}
+
+// RemoveProxy 从代理池中删除代理，不存在时返回 false
+func (m *SocksProxyManager) RemoveProxy(proxyURL string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.proxyMap[proxyURL]; !ok {
+		return false
+	}
+	delete(m.proxyMap, proxyURL)
+	if m.lastProxyURL == proxyURL {
+		m.lastProxyURL = ""
+	}
+	m.notifyPool()
+	return true
+}
+
+// SetDisabled 停用或启用代理，停用的代理不参与轮询但仍会被复检
+func (m *SocksProxyManager) SetDisabled(proxyURL string, disabled bool) bool {
+	return m.update(proxyURL, func(p *ProxyInfo) { p.Disabled = disabled })
+}
+
+// SetPinned 固定或取消固定代理
+func (m *SocksProxyManager) SetPinned(proxyURL string, pinned bool) bool {
+	return m.update(proxyURL, func(p *ProxyInfo) { p.Pinned = pinned })
+}
+
+// update 在写锁内修改代理，不存在时返回 false
+func (m *SocksProxyManager) update(proxyURL string, fn func(p *ProxyInfo)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.proxyMap[proxyURL]
+	if !ok {
+		return false
+	}
+	fn(p)
+	return true
+}
+
+// Recheck 立即重新检测代理并返回检测后的副本
+func (m *SocksProxyManager) Recheck(ctx context.Context, proxyURL string) (*ProxyInfo, error) {
+	m.mu.RLock()
+	p, ok := m.proxyMap[proxyURL]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrProxyNotFound
+	}
+
+	err := m.recheck(ctx, p)
+	c, ok := m.Proxy(proxyURL)
+	if !ok {
+		return nil, ErrProxyNotFound
+	}
+	return c, err
+}
+
+// FetchSource 立即在后台从指定代理源获取一次代理，不受获取间隔与代理池最小数量的限制
+func (m *SocksProxyManager) FetchSource(name string) error {
+	for _, s := range m.Sources() {
+		if s.Name() != name {
+			continue
+		}
+		if !m.enter() {
+			return ErrManagerClosed
+		}
+		go func() {
+			defer m.wg.Done()
+			m.logger.Infof("手动触发代理源获取: %s", name)
+			m.sched.recordYield(name, m.fetchSource(m.ctx, s, 0))
+		}()
+		return nil
+	}
+	return ErrSourceNotFound
+}
+
+// SourceStatuses 返回所有代理源的状态
+func (m *SocksProxyManager) SourceStatuses() []SourceStatus {
+	sources := m.Sources()
+	statuses := make([]SourceStatus, 0, len(sources))
+	index := make(map[string]int, len(sources))
+	for i, s := range sources {
+		index[s.Name()] = i
+		statuses = append(statuses, SourceStatus{
+			Name:      s.Name(),
+			Available: s.IsAvailable(),
+			LastFetch: s.LastFetchTime(),
+			Status:    s.Status(),
+		})
+		plan, y := m.sched.plan(s.Name()), m.sched.yield(s.Name())
+		statuses[i].NextFetch, statuses[i].FetchPlan = plan.Next, plan.Reason
+		statuses[i].LastFetched, statuses[i].LastAccepted = y.Fetched, y.Accepted
+		total := m.sched.total(s.Name())
+		statuses[i].Scheduling = m.sched.schedule(s.Name())
+		statuses[i].Fetched, statuses[i].Accepted, statuses[i].Yield = total.Fetched, total.Accepted, total.ratio()
+		if r, ok := s.(interface{ UnavailableReason() string }); ok {
+			statuses[i].Reason = r.UnavailableReason()
+		}
+		if c, ok := s.(creditReporter); ok {
+			if state, ok := c.CreditState(); ok {
+				statuses[i].Credits = &state
+			}
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.proxyMap {
+		i, ok := index[p.Source]
+		if !ok {
+			continue
+		}
+		statuses[i].Proxies++
+		if p.IsAlive {
+			statuses[i].Alive++
+		}
+	}
+	return statuses
+}
+
+// SourceHealths 返回所有代理源的健康状态，用于 Prometheus 指标
+func (m *SocksProxyManager) SourceHealths() []metrics.SourceHealth {
+	sources := m.Sources()
+	healths := make([]metrics.SourceHealth, 0, len(sources))
+	for _, s := range sources {
+		status := s.Status()
+		healths = append(healths, metrics.SourceHealth{
+			Source:              s.Name(),
+			Health:              string(status.Health),
+			ConsecutiveFailures: status.ConsecutiveFailures,
+		})
+	}
+	return healths
+}
+
+// Stats 返回代理池的整体统计
+func (m *SocksProxyManager) Stats() PoolStats {
+	stats := PoolStats{CheckLimit: m.limiter.Limit(), MinSize: m.conf().CheckSock.MinSize, Target: m.targetSize()}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.proxyMap {
+		stats.Total++
+		if p.IsAlive {
+			stats.Alive++
+		}
+		if p.Disabled {
+			stats.Disabled++
+		}
+		if p.Pinned {
+			stats.Pinned++
+		}
+	}
+	return stats
+}
+
+// PoolGroups 按状态、来源与国家统计代理池，用于 Prometheus 指标
+func (m *SocksProxyManager) PoolGroups() []metrics.PoolGroup {
+	counts := make(map[metrics.PoolGroup]int)
+	m.mu.RLock()
+	for _, p := range m.proxyMap {
+		g := metrics.PoolGroup{State: "dead", Source: p.Source, Country: p.Country}
+		switch {
+		case p.Disabled:
+			g.State = "disabled"
+		case p.IsAlive:
+			g.State = "alive"
+		}
+		if g.Source == "" {
+			g.Source = "unknown"
+		}
+		if g.Country == "" {
+			g.Country = "unknown"
+		}
+		counts[g]++
+	}
+	m.mu.RUnlock()
+
+	groups := make([]metrics.PoolGroup, 0, len(counts))
+	for g, n := range counts {
+		g.Count = n
+		groups = append(groups, g)
+	}
+	return groups
+}
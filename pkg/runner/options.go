@@ -6,11 +6,19 @@ import (
 	"github.com/projectdiscovery/goflags"
 	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/gologger/levels"
+	"github.com/wjlin0/deadpool/pkg/acl"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/router"
+	"github.com/wjlin0/deadpool/pkg/source"
 	"github.com/wjlin0/deadpool/pkg/types"
 	updateutils "github.com/wjlin0/utils/update"
 	"gopkg.in/yaml.v3"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +29,8 @@ func ParserOptions() *types.Options {
 	set.CreateGroup("Input", "输入",
 		set.StringVarP(&options.ConfigPath, "config", "c", "config.yaml", "配置文件"),
 		set.StringVarP(&options.AliveDataPath, "alive-data-path", "adp", "aliveDataPath.json", "存储的存活IP列表"),
+		set.StringVarP(&options.QuotaDataPath, "quota-data-path", "qdp", "quotaUsage.json", "存储的用户配额用量"),
+		set.StringVarP(&options.CreditDataPath, "credit-data-path", "cdp", "sourceCredits.json", "存储的搜索引擎积分用量与翻页进度"),
 	)
 	set.CreateGroup("Config", "配置",
 		set.BoolVar(&options.Debug, "debug", false, "调试模式"),
@@ -62,62 +72,8 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 	// 2. 检查文件是否存在
 	if _, err := os.Stat(opts.ConfigPath); os.IsNotExist(err) {
 		// 3. 文件不存在时创建默认配置（完全保持您的默认值）
-		defaultConfig := &types.ConfigOptions{
-			Listener: &types.Listener{
-				IP:    "0.0.0.0",  // 保持您的默认值
-				Port:  1080,       // 保持您的默认值
-				Auths: []string{}, // 保持您的默认值
-			},
-			CheckSock: &types.CheckSock{
-				CheckURL:         []string{"https://www.baidu.com"}, // 保持您的默认值
-				CheckRspKeywords: []string{"百度一下"},                  // 保持您的默认值
-				MaxConcurrentReq: 50,                                // 保持您的默认值
-				CheckInterval:    60,                                // 保持您的默认值
-				MinSize:          50,                                // 保持您的默认值
-			},
-			CheckGeolocate: &types.CheckGeolocate{
-				Enabled: true,
-				CheckURL: []string{
-					"https://qifu-api.baidubce.com/ip/local/geo/v1/district",
-					"https://ipapi.co/json",
-				}, // 保持您的默认值
-				ExcludeKeywords:         []string{"澳门", "香港", "台湾"},            // 保持您的默认值
-				IncludeKeywords:         []string{"中国", "\"country\": \"CN\""}, // 保持您的默认值
-				IncludeKeywordCondition: "or",
-				ExcludeKeywordCondition: "or",
-			},
-			SourcesConfig: &types.SourcesConfig{
-				Hunter: &types.HunterSource{
-					Enabled:       false,
-					Endpoint:      "https://hunter.qianxin.com/openApi/search",
-					Query:         "protocol==\"socks5\"&& protocol.banner=\"No authentication\"&&ip.country=\"CN\"",
-					CheckInterval: 60,
-					QueryTimeout:  60,
-					MaxSize:       50,
-				},
-				Quake: &types.QuakeSource{
-					Enabled:       false,
-					Endpoint:      "https://quake.360.net/api/v3/search/quake_service",
-					Query:         "service:socks5  AND country: \"CN\" AND response:\"No authentication\"",
-					CheckInterval: 60,
-					QueryTimeout:  5,
-					MaxSize:       50,
-				},
-				File: &types.FileSource{
-					Enabled:       false,
-					Path:          "proxies.txt",
-					CheckInterval: 60 * 5,
-				},
-				CheckerProxy: &types.CheckerProxy{
-					Enabled:       true,
-					Endpoint:      "https://api.checkerproxy.net/v1/landing/archive",
-					CheckInterval: 60,
-					QueryTimeout:  60,
-				},
-				Customs: []*types.Custom{},
-			},
-			Options: opts,
-		}
+		defaultConfig := DefaultConfigOptions()
+		defaultConfig.Options = opts
 
 		// 原子写入默认配置
 		if err := saveConfigToFile(opts.ConfigPath, defaultConfig); err != nil {
@@ -137,7 +93,151 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 		return nil, fmt.Errorf("failed to parse YAML config: %v", err)
 	}
 
-	// 5. 初始化配置（完全保持您的默认值设置逻辑）
+	// 5. 补齐默认值并校验
+	if err := NormalizeConfigOptions(&config); err != nil {
+		return nil, err
+	}
+
+	config.Options = opts
+	return &config, nil
+}
+
+// DefaultConfigOptions 返回首次运行时写入的默认配置
+func DefaultConfigOptions() *types.ConfigOptions {
+	return &types.ConfigOptions{
+		Listener: &types.Listener{
+			IP:       "0.0.0.0",  // 保持您的默认值
+			Port:     1080,       // 保持您的默认值
+			Auths:    []string{}, // 保持您的默认值
+			Timeouts: defaultListenerTimeouts(),
+
+			ShutdownTimeout: 30,
+		},
+		CheckSock: &types.CheckSock{
+			CheckURL:         []string{"https://www.baidu.com"}, // 保持您的默认值
+			CheckRspKeywords: []string{"百度一下"},                  // 保持您的默认值
+			MaxConcurrentReq: 50,                                // 保持您的默认值
+			CheckInterval:    60,                                // 保持您的默认值
+			MinSize:          50,                                // 保持您的默认值
+			Headroom:         intPtr(10),
+			MinConcurrentReq: 5,
+			Adaptive:         true,
+			TimeoutRatio:     0.3,
+			MaxLatency:       5000,
+			Timeouts:         defaultCheckTimeouts(60),
+			PreCheck: &types.PreCheck{
+				Enabled:       true,
+				ConnectTarget: "www.baidu.com:443",
+			},
+		},
+		CheckGeolocate: &types.CheckGeolocate{
+			Enabled: true,
+			CheckURL: []string{
+				"https://qifu-api.baidubce.com/ip/local/geo/v1/district",
+				"https://ipapi.co/json",
+			}, // 保持您的默认值
+			ExcludeKeywords:         []string{"澳门", "香港", "台湾"},            // 保持您的默认值
+			IncludeKeywords:         []string{"中国", "\"country\": \"CN\""}, // 保持您的默认值
+			IncludeKeywordCondition: "or",
+			ExcludeKeywordCondition: "or",
+		},
+		SourcesConfig: &types.SourcesConfig{
+			Hunter: &types.HunterSource{
+				Enabled:       false,
+				Endpoint:      "https://hunter.qianxin.com/openApi/search",
+				Query:         "protocol==\"socks5\"&& protocol.banner=\"No authentication\"&&ip.country=\"CN\"",
+				PageSize:      50,
+				Days:          1,
+				CheckInterval: 60,
+				QueryTimeout:  60,
+				MaxSize:       50,
+				Scheduling:    types.Scheduling{Cost: intPtr(1)}, // 搜索引擎按积分计费，代理池不足时排在免费数据源之后
+			},
+			Quake: &types.QuakeSource{
+				Enabled:       false,
+				Endpoint:      "https://quake.360.net/api/v3/search/quake_service",
+				Query:         "service:socks5  AND country: \"CN\" AND response:\"No authentication\"",
+				PageSize:      10,
+				Days:          7,
+				CheckInterval: 60,
+				QueryTimeout:  5,
+				MaxSize:       50,
+				Scheduling:    types.Scheduling{Cost: intPtr(1)},
+			},
+			Fofa: &types.FofaSource{
+				Enabled:       false,
+				Endpoint:      "https://fofa.info/api/v1/search/all",
+				Query:         "protocol==\"socks5\" && banner=\"No Authentication\" && country=\"CN\"",
+				PageSize:      100,
+				Fields:        []string{"ip", "port", "protocol"},
+				Days:          30,
+				CheckInterval: 60,
+				QueryTimeout:  60,
+				MaxSize:       50,
+				Scheduling:    types.Scheduling{Cost: intPtr(1)},
+			},
+			Shodan: &types.ShodanSource{
+				Enabled:       false,
+				Endpoint:      "https://api.shodan.io/shodan/host/search",
+				Query:         "socks5 country:CN",
+				CheckInterval: 60,
+				QueryTimeout:  60,
+				MaxSize:       50,
+				Scheduling:    types.Scheduling{Cost: intPtr(1)},
+			},
+			ZoomEye: &types.ZoomEyeSource{
+				Enabled:       false,
+				Endpoint:      "https://api.zoomeye.ai/v2/search",
+				Query:         "service=\"socks5\" && country=\"CN\"",
+				PageSize:      20,
+				CheckInterval: 60,
+				QueryTimeout:  60,
+				MaxSize:       50,
+				Scheduling:    types.Scheduling{Cost: intPtr(1)},
+			},
+			Censys: &types.CensysSource{
+				Enabled:       false,
+				Endpoint:      "https://search.censys.io/api/v2/hosts/search",
+				Query:         "services.service_name: SOCKS and location.country_code: CN",
+				PageSize:      100,
+				CheckInterval: 60,
+				QueryTimeout:  60,
+				MaxSize:       50,
+				Scheduling:    types.Scheduling{Cost: intPtr(1)},
+			},
+			File: &types.FileSource{
+				Enabled:       false,
+				Path:          "proxies.txt",
+				Watch:         true,
+				Prune:         true,
+				CheckInterval: 60 * 5,
+			},
+			CheckerProxy: &types.CheckerProxy{
+				Enabled:       true,
+				Endpoint:      "https://api.checkerproxy.net/v1/landing/archive",
+				CheckInterval: 60,
+				QueryTimeout:  60,
+			},
+			Customs: []*types.Custom{},
+		},
+		Admin: &types.Admin{
+			Enabled: false,
+			IP:      "127.0.0.1",
+			Port:    8081,
+		},
+		AccessLog: &types.AccessLog{
+			Enabled:    false,
+			Path:       "access.log",
+			Format:     "json",
+			MaxSize:    100,
+			MaxBackups: 5,
+		},
+	}
+}
+
+// NormalizeConfigOptions 为未配置的项补齐默认值并校验配置
+func NormalizeConfigOptions(config *types.ConfigOptions) error {
+	// 初始化配置（完全保持您的默认值设置逻辑）
 	if config.Listener == nil {
 		config.Listener = &types.Listener{}
 	}
@@ -160,6 +260,12 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 	if config.SourcesConfig == nil {
 		config.SourcesConfig = &types.SourcesConfig{}
 	}
+	if config.Admin == nil {
+		config.Admin = &types.Admin{}
+	}
+	if config.AccessLog == nil {
+		config.AccessLog = &types.AccessLog{}
+	}
 
 	// 设置Listener默认值
 	if config.Listener.IP == "" {
@@ -171,6 +277,68 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 	if config.Listener.Auths == nil {
 		config.Listener.Auths = []string{}
 	}
+	config.Listener.Timeouts = fillTimeouts(config.Listener.Timeouts, defaultListenerTimeouts())
+	if config.Listener.ShutdownTimeout == 0 {
+		config.Listener.ShutdownTimeout = 30
+	}
+	if err := quota.Validate(config.Listener.Quotas); err != nil {
+		return fmt.Errorf("listener.quotas: %v", err)
+	}
+	if _, err := acl.NewClient(config.Listener.Allow, config.Listener.Deny, config.Listener.AuthExempt); err != nil {
+		return fmt.Errorf("listener.%v", err)
+	}
+	if _, err := acl.NewDestination(config.Listener.Destinations); err != nil {
+		return fmt.Errorf("listener.destinations: %v", err)
+	}
+	if err := dns.Validate(config.Listener.DNS); err != nil {
+		return fmt.Errorf("listener.dns: %v", err)
+	}
+	for name, pool := range config.Pools {
+		if pool == nil {
+			continue
+		}
+		if err := dns.Validate(pool.DNS); err != nil {
+			return fmt.Errorf("pools.%s.dns: %v", name, err)
+		}
+		if pool.MaxLatency < 0 {
+			return fmt.Errorf("pools.%s.maxLatency must not be negative, got %d", name, pool.MaxLatency)
+		}
+	}
+	if err := router.Validate(config); err != nil {
+		return fmt.Errorf("routing: %v", err)
+	}
+	if len(config.Listener.AuthExempt) > 0 && len(config.Listener.Auths) == 0 && config.Listener.UsersFile == "" {
+		return errors.New("listener.authExempt requires auths or usersFile")
+	}
+
+	// 设置Admin默认值
+	if config.Admin.IP == "" {
+		config.Admin.IP = "127.0.0.1"
+	}
+	if config.Admin.Port == 0 {
+		config.Admin.Port = 8081
+	}
+	if config.Admin.Enabled && config.Admin.Token == "" {
+		return errors.New("admin.token must not be empty when admin is enabled")
+	}
+
+	// 设置AccessLog默认值
+	if config.AccessLog.Path == "" {
+		config.AccessLog.Path = "access.log"
+	}
+	switch config.AccessLog.Format {
+	case "":
+		config.AccessLog.Format = "json"
+	case "json", "text":
+	default:
+		return fmt.Errorf("accessLog.format must be json or text, got %q", config.AccessLog.Format)
+	}
+	if config.AccessLog.MaxSize == 0 {
+		config.AccessLog.MaxSize = 100
+	}
+	if config.AccessLog.MaxBackups == 0 {
+		config.AccessLog.MaxBackups = 5
+	}
 
 	// 设置CheckSock默认值
 	if config.CheckSock.CheckURL == nil {
@@ -182,12 +350,48 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 	if config.CheckSock.MaxConcurrentReq == 0 {
 		config.CheckSock.MaxConcurrentReq = 50
 	}
+	if config.CheckSock.MinConcurrentReq == 0 {
+		config.CheckSock.MinConcurrentReq = 5
+	}
+	if config.CheckSock.MinConcurrentReq > config.CheckSock.MaxConcurrentReq {
+		return fmt.Errorf("checkSock.minConcurrentReq (%d) must not exceed maxConcurrentReq (%d)", config.CheckSock.MinConcurrentReq, config.CheckSock.MaxConcurrentReq)
+	}
+	if config.CheckSock.TimeoutRatio <= 0 || config.CheckSock.TimeoutRatio > 1 {
+		config.CheckSock.TimeoutRatio = 0.3
+	}
 	if config.CheckSock.CheckInterval == 0 {
 		config.CheckSock.CheckInterval = 60
 	}
 	if config.CheckSock.MinSize == 0 {
 		config.CheckSock.MinSize = 50
 	}
+	if config.CheckSock.Headroom == nil {
+		config.CheckSock.Headroom = intPtr(10)
+	}
+	if *config.CheckSock.Headroom < 0 {
+		return fmt.Errorf("checkSock.headroom must not be negative, got %d", *config.CheckSock.Headroom)
+	}
+	if config.CheckSock.MaxLatency == 0 {
+		config.CheckSock.MaxLatency = 5000
+	}
+	// 未配置总超时时沿用 checkInterval，兼容旧配置
+	config.CheckSock.Timeouts = fillTimeouts(config.CheckSock.Timeouts, defaultCheckTimeouts(config.CheckSock.CheckInterval))
+	if config.CheckSock.PreCheck == nil {
+		config.CheckSock.PreCheck = &types.PreCheck{
+			Enabled:       true,
+			ConnectTarget: "www.baidu.com:443",
+		}
+	} else {
+		if config.CheckSock.PreCheck.ConnectTarget == "" {
+			config.CheckSock.PreCheck.ConnectTarget = "www.baidu.com:443"
+		}
+		if _, _, err := net.SplitHostPort(config.CheckSock.PreCheck.ConnectTarget); err != nil {
+			return fmt.Errorf("checkSock.preCheck.connectTarget must be host:port: %v", err)
+		}
+	}
+	if err := dns.Validate(config.CheckSock.DNS); err != nil {
+		return fmt.Errorf("checkSock.dns: %v", err)
+	}
 
 	// 设置CheckGeolocate默认值
 	if config.CheckGeolocate.CheckURL == nil {
@@ -216,9 +420,12 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 			Enabled:       false,
 			Endpoint:      "https://hunter.qianxin.com/openApi/search",
 			Query:         "protocol==\"socks5\"&& protocol.banner=\"No authentication\"&&ip.country=\"CN\"",
+			PageSize:      50,
+			Days:          1,
 			CheckInterval: 60,
 			QueryTimeout:  60,
 			MaxSize:       50,
+			Scheduling:    types.Scheduling{Cost: intPtr(1)},
 		}
 	} else {
 		if config.SourcesConfig.Hunter.Endpoint == "" {
@@ -236,6 +443,15 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 		if config.SourcesConfig.Hunter.MaxSize == 0 {
 			config.SourcesConfig.Hunter.MaxSize = 50
 		}
+		if config.SourcesConfig.Hunter.Cost == nil {
+			config.SourcesConfig.Hunter.Cost = intPtr(1)
+		}
+		if config.SourcesConfig.Hunter.PageSize == 0 {
+			config.SourcesConfig.Hunter.PageSize = 50
+		}
+		if config.SourcesConfig.Hunter.Days == 0 {
+			config.SourcesConfig.Hunter.Days = 1
+		}
 	}
 
 	if config.SourcesConfig.Quake == nil {
@@ -243,9 +459,12 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 			Enabled:       false,
 			Endpoint:      "https://quake.360.net/api/v3/search/quake_service",
 			Query:         "service:socks5  AND country: \"CN\" AND response:\"No authentication\"",
+			PageSize:      10,
+			Days:          7,
 			CheckInterval: 60,
 			QueryTimeout:  60,
 			MaxSize:       50,
+			Scheduling:    types.Scheduling{Cost: intPtr(1)},
 		}
 	} else {
 		if config.SourcesConfig.Quake.Endpoint == "" {
@@ -263,22 +482,193 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 		if config.SourcesConfig.Quake.MaxSize == 0 {
 			config.SourcesConfig.Quake.MaxSize = 50
 		}
+		if config.SourcesConfig.Quake.Cost == nil {
+			config.SourcesConfig.Quake.Cost = intPtr(1)
+		}
+		if config.SourcesConfig.Quake.PageSize == 0 {
+			config.SourcesConfig.Quake.PageSize = 10
+		}
+		if config.SourcesConfig.Quake.Days == 0 {
+			config.SourcesConfig.Quake.Days = 7
+		}
+	}
+
+	if config.SourcesConfig.Fofa == nil {
+		config.SourcesConfig.Fofa = &types.FofaSource{
+			Enabled:       false,
+			Endpoint:      "https://fofa.info/api/v1/search/all",
+			Query:         "protocol==\"socks5\" && banner=\"No Authentication\" && country=\"CN\"",
+			PageSize:      100,
+			Fields:        []string{"ip", "port", "protocol"},
+			Days:          30,
+			CheckInterval: 60,
+			QueryTimeout:  60,
+			MaxSize:       50,
+			Scheduling:    types.Scheduling{Cost: intPtr(1)},
+		}
+	} else {
+		fofa := config.SourcesConfig.Fofa
+		if fofa.Endpoint == "" {
+			fofa.Endpoint = "https://fofa.info/api/v1/search/all"
+		}
+		if fofa.Query == "" {
+			fofa.Query = "protocol==\"socks5\" && banner=\"No Authentication\" && country=\"CN\""
+		}
+		if fofa.PageSize == 0 {
+			fofa.PageSize = 100
+		}
+		if len(fofa.Fields) == 0 {
+			fofa.Fields = []string{"ip", "port", "protocol"}
+		}
+		if fofa.CheckInterval == 0 {
+			fofa.CheckInterval = 60
+		}
+		if fofa.QueryTimeout == 0 {
+			fofa.QueryTimeout = 60
+		}
+		if fofa.MaxSize == 0 {
+			fofa.MaxSize = 50
+		}
+		if fofa.Cost == nil {
+			fofa.Cost = intPtr(1)
+		}
+		if err := validateFofa(fofa); err != nil {
+			return err
+		}
+	}
+
+	if config.SourcesConfig.Shodan == nil {
+		config.SourcesConfig.Shodan = &types.ShodanSource{
+			Enabled:       false,
+			Endpoint:      "https://api.shodan.io/shodan/host/search",
+			Query:         "socks5 country:CN",
+			CheckInterval: 60,
+			QueryTimeout:  60,
+			MaxSize:       50,
+			Scheduling:    types.Scheduling{Cost: intPtr(1)},
+		}
+	} else {
+		shodan := config.SourcesConfig.Shodan
+		if shodan.Endpoint == "" {
+			shodan.Endpoint = "https://api.shodan.io/shodan/host/search"
+		}
+		if shodan.Query == "" {
+			shodan.Query = "socks5 country:CN"
+		}
+		if shodan.CheckInterval == 0 {
+			shodan.CheckInterval = 60
+		}
+		if shodan.QueryTimeout == 0 {
+			shodan.QueryTimeout = 60
+		}
+		if shodan.MaxSize == 0 {
+			shodan.MaxSize = 50
+		}
+		if shodan.Cost == nil {
+			shodan.Cost = intPtr(1)
+		}
+	}
+
+	if config.SourcesConfig.ZoomEye == nil {
+		config.SourcesConfig.ZoomEye = &types.ZoomEyeSource{
+			Enabled:       false,
+			Endpoint:      "https://api.zoomeye.ai/v2/search",
+			Query:         "service=\"socks5\" && country=\"CN\"",
+			PageSize:      20,
+			CheckInterval: 60,
+			QueryTimeout:  60,
+			MaxSize:       50,
+			Scheduling:    types.Scheduling{Cost: intPtr(1)},
+		}
+	} else {
+		zoomeye := config.SourcesConfig.ZoomEye
+		if zoomeye.Endpoint == "" {
+			zoomeye.Endpoint = "https://api.zoomeye.ai/v2/search"
+		}
+		if zoomeye.Query == "" {
+			zoomeye.Query = "service=\"socks5\" && country=\"CN\""
+		}
+		if zoomeye.PageSize == 0 {
+			zoomeye.PageSize = 20
+		}
+		if zoomeye.CheckInterval == 0 {
+			zoomeye.CheckInterval = 60
+		}
+		if zoomeye.QueryTimeout == 0 {
+			zoomeye.QueryTimeout = 60
+		}
+		if zoomeye.MaxSize == 0 {
+			zoomeye.MaxSize = 50
+		}
+		if zoomeye.Cost == nil {
+			zoomeye.Cost = intPtr(1)
+		}
+	}
+
+	if config.SourcesConfig.Censys == nil {
+		config.SourcesConfig.Censys = &types.CensysSource{
+			Enabled:       false,
+			Endpoint:      "https://search.censys.io/api/v2/hosts/search",
+			Query:         "services.service_name: SOCKS and location.country_code: CN",
+			PageSize:      100,
+			CheckInterval: 60,
+			QueryTimeout:  60,
+			MaxSize:       50,
+			Scheduling:    types.Scheduling{Cost: intPtr(1)},
+		}
+	} else {
+		censys := config.SourcesConfig.Censys
+		if censys.Endpoint == "" {
+			censys.Endpoint = "https://search.censys.io/api/v2/hosts/search"
+		}
+		if censys.Query == "" {
+			censys.Query = "services.service_name: SOCKS and location.country_code: CN"
+		}
+		if censys.PageSize == 0 {
+			censys.PageSize = 100
+		}
+		if censys.CheckInterval == 0 {
+			censys.CheckInterval = 60
+		}
+		if censys.QueryTimeout == 0 {
+			censys.QueryTimeout = 60
+		}
+		if censys.MaxSize == 0 {
+			censys.MaxSize = 50
+		}
+		if censys.Cost == nil {
+			censys.Cost = intPtr(1)
+		}
+	}
+
+	if err := validateEngines(config.SourcesConfig); err != nil {
+		return err
 	}
 
 	if config.SourcesConfig.File == nil {
 		config.SourcesConfig.File = &types.FileSource{
 			Enabled:       false,
 			Path:          "proxies.txt",
+			Watch:         true,
+			Prune:         true,
 			CheckInterval: 60 * 5,
 		}
 	} else {
-		if config.SourcesConfig.File.Path == "" {
+		if config.SourcesConfig.File.Path == "" && len(config.SourcesConfig.File.Paths) == 0 {
 			config.SourcesConfig.File.Path = "proxies.txt"
 		}
 		if config.SourcesConfig.File.CheckInterval == 0 {
 			config.SourcesConfig.File.CheckInterval = 60 * 5
 		}
 	}
+	for _, pattern := range config.SourcesConfig.File.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("sourcesConfig.file.paths: invalid pattern %q: %v", pattern, err)
+		}
+	}
+	if _, err := source.NewNormalizer(config.SourcesConfig.File.Formats, config.SourcesConfig.File.Scheme); err != nil {
+		return fmt.Errorf("sourcesConfig.file: %v", err)
+	}
 
 	if config.SourcesConfig.CheckerProxy == nil {
 		config.SourcesConfig.CheckerProxy = &types.CheckerProxy{
@@ -303,25 +693,25 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 		for i, c := range config.SourcesConfig.Customs {
 			if c.Endpoint == "" {
 				//gologger.Fatal().Msgf("Customs[%d].Endpoint is required\n", i)
-				return nil, errors.New(fmt.Sprintf("Customs[%d].endpoint is required\n", i))
+				return errors.New(fmt.Sprintf("Customs[%d].endpoint is required\n", i))
 			}
-			// 判断 c.ResponseType 是否为 json 、 text
+			// 判断 c.ResponseType 是否为 json 、 text 、 xpath 、 regex 、 csv
 
 			if c.ResponseType == "" {
 				gologger.Info().Msgf("Customs[%d].type is required, use default value: text\n", i)
 				c.ResponseType = "text"
 			}
 
-			if c.ResponseType != "json" && c.ResponseType != "text" && c.ResponseType != "xpath" {
+			if c.ResponseType != "json" && c.ResponseType != "text" && c.ResponseType != "xpath" && c.ResponseType != "regex" && c.ResponseType != "csv" {
 				//gologger.Fatal().Msgf("Customs[%d].ResponseType must be json or txt\n", i)
-				return nil, errors.New(fmt.Sprintf("Customs[%d].type must be json or text or xpath\n", i))
+				return errors.New(fmt.Sprintf("Customs[%d].type must be json or text or xpath or regex or csv\n", i))
 			}
 			if c.ResponseType == "json" {
 				if c.Extract == nil {
-					return nil, errors.New(fmt.Sprintf("Customs[%d].json is required\n", i))
+					return errors.New(fmt.Sprintf("Customs[%d].json is required\n", i))
 				}
 				if c.Extract.ProxyListPath == "" {
-					return nil, errors.New(fmt.Sprintf("Customs[%d].json.path is required\n", i))
+					return errors.New(fmt.Sprintf("Customs[%d].json.path is required\n", i))
 				}
 				if c.Extract.IPField == "" {
 					gologger.Info().Msgf("Customs[%d].json.ipField is required, use default value: ip\n", i)
@@ -343,10 +733,10 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 			}
 			if c.ResponseType == "xpath" {
 				if c.Extract == nil {
-					return nil, errors.New(fmt.Sprintf("Customs[%d].xpath is required\n", i))
+					return errors.New(fmt.Sprintf("Customs[%d].xpath is required\n", i))
 				}
 				if c.Extract.ProxyListPath == "" {
-					return nil, errors.New(fmt.Sprintf("Customs[%d].xpath.path is required\n", i))
+					return errors.New(fmt.Sprintf("Customs[%d].xpath.path is required\n", i))
 				}
 				if c.Extract.IPField == "" {
 					gologger.Info().Msgf("Customs[%d].xpath.ipField is required, use default value: ip\n", i)
@@ -367,6 +757,70 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 
 			}
 
+			if c.ResponseType == "regex" {
+				if c.Extract == nil {
+					return errors.New(fmt.Sprintf("Customs[%d].extract is required\n", i))
+				}
+				if c.Extract.ProxyListPath == "" {
+					return errors.New(fmt.Sprintf("Customs[%d].extract.path is required\n", i))
+				}
+				re, err := regexp.Compile(c.Extract.ProxyListPath)
+				if err != nil {
+					return fmt.Errorf("Customs[%d].extract.path is not a valid regex: %v", i, err)
+				}
+				if c.Extract.IPField == "" {
+					gologger.Info().Msgf("Customs[%d].extract.ipField is required, use default value: ip\n", i)
+					c.Extract.IPField = "ip"
+				}
+				if c.Extract.PortField == "" {
+					gologger.Info().Msgf("Customs[%d].extract.portField is required, use default value: port\n", i)
+					c.Extract.PortField = "port"
+				}
+				if c.Extract.UserField == "" {
+					c.Extract.UserField = "username"
+				}
+				if c.Extract.PasswordField == "" {
+					c.Extract.PasswordField = "password"
+				}
+				if c.Extract.SchemeField == "" {
+					c.Extract.SchemeField = "scheme"
+				}
+				// ip 与 port 必须有对应的命名分组，其余分组可选
+				if re.SubexpIndex(c.Extract.IPField) < 0 || re.SubexpIndex(c.Extract.PortField) < 0 {
+					return fmt.Errorf("Customs[%d].extract.path must contain named groups (?P<%s>...) and (?P<%s>...)", i, c.Extract.IPField, c.Extract.PortField)
+				}
+			}
+			if c.ResponseType == "csv" {
+				if c.Extract == nil {
+					c.Extract = &types.ProxyExtractConfig{}
+				}
+				if c.Extract.IPField == "" {
+					gologger.Info().Msgf("Customs[%d].extract.ipField is required, use default value: ip\n", i)
+					c.Extract.IPField = "ip"
+				}
+				if c.Extract.PortField == "" {
+					gologger.Info().Msgf("Customs[%d].extract.portField is required, use default value: port\n", i)
+					c.Extract.PortField = "port"
+				}
+				if c.Extract.UserField == "" {
+					c.Extract.UserField = "username"
+				}
+				if c.Extract.PasswordField == "" {
+					c.Extract.PasswordField = "password"
+				}
+				if c.Extract.SchemeField == "" {
+					c.Extract.SchemeField = "protocol"
+				}
+				for _, f := range []string{c.Extract.IPField, c.Extract.PortField, c.Extract.UserField, c.Extract.PasswordField, c.Extract.SchemeField} {
+					if n, err := strconv.Atoi(f); err == nil && n < 0 {
+						return fmt.Errorf("Customs[%d].extract: column index must not be negative, got %d", i, n)
+					}
+				}
+			}
+			if _, err := source.NewNormalizer(c.Formats, c.Scheme); err != nil {
+				return fmt.Errorf("Customs[%d]: %v", i, err)
+			}
+
 			if c.EnablePaging {
 				// 检查endpoint和body中是否至少有一个包含分页参数
 				hasPageInEndpoint := strings.Contains(c.Endpoint, "{page}")
@@ -375,7 +829,7 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 				hasSizeInBody := strings.Contains(c.Body, "{pageSize}")
 
 				if !(hasPageInEndpoint || hasPageInBody) {
-					return nil, errors.New("启用分页功能时，必须在endpoint或body中包含{page}参数")
+					return errors.New("启用分页功能时，必须在endpoint或body中包含{page}参数")
 				}
 				if !(hasSizeInEndpoint || hasSizeInBody) {
 					gologger.Warning().Msgf("启用分页功能时，无 {pageSize} 参数，将使用默认值或自定义字段\n")
@@ -396,8 +850,192 @@ func ParserConfigOptions(opts *types.Options) (*types.ConfigOptions, error) {
 		}
 	}
 
-	config.Options = opts
-	return &config, nil
+	// 文件、CheckerProxy 与自定义数据源免费，未配置成本时为 0
+	free := []*types.Scheduling{&config.SourcesConfig.File.Scheduling, &config.SourcesConfig.CheckerProxy.Scheduling}
+	for _, c := range config.SourcesConfig.Customs {
+		free = append(free, &c.Scheduling)
+	}
+	for _, sched := range free {
+		if sched.Cost == nil {
+			sched.Cost = intPtr(0)
+		}
+	}
+	if err := validateQueryTimeouts(config.SourcesConfig); err != nil {
+		return err
+	}
+	return validateScheduling(config.SourcesConfig)
+}
+
+// maxQueryTimeout queryTimeout 的上限(分钟)，超过一天的值多半是按秒填写的
+const maxQueryTimeout = 24 * 60
+
+// validateQueryTimeouts 校验数据源的获取间隔，queryTimeout 的单位是分钟
+func validateQueryTimeouts(sc *types.SourcesConfig) error {
+	timeouts := map[string]int{
+		"hunter":       sc.Hunter.QueryTimeout,
+		"quake":        sc.Quake.QueryTimeout,
+		"fofa":         sc.Fofa.QueryTimeout,
+		"shodan":       sc.Shodan.QueryTimeout,
+		"zoomeye":      sc.ZoomEye.QueryTimeout,
+		"censys":       sc.Censys.QueryTimeout,
+		"file":         sc.File.QueryTimeout,
+		"checkerProxy": sc.CheckerProxy.QueryTimeout,
+	}
+	for i, c := range sc.Customs {
+		timeouts[fmt.Sprintf("customs[%d]", i)] = c.QueryTimeout
+	}
+	for name, minutes := range timeouts {
+		if minutes < 0 || minutes > maxQueryTimeout {
+			return fmt.Errorf("sourcesConfig.%s.queryTimeout is in minutes and must be between 1 and %d, got %d", name, maxQueryTimeout, minutes)
+		}
+	}
+	return nil
+}
+
+// validateScheduling 校验数据源的优先级与成本
+func validateScheduling(sc *types.SourcesConfig) error {
+	schedules := map[string]types.Scheduling{
+		"hunter":       sc.Hunter.Scheduling,
+		"quake":        sc.Quake.Scheduling,
+		"fofa":         sc.Fofa.Scheduling,
+		"shodan":       sc.Shodan.Scheduling,
+		"zoomeye":      sc.ZoomEye.Scheduling,
+		"censys":       sc.Censys.Scheduling,
+		"file":         sc.File.Scheduling,
+		"checkerProxy": sc.CheckerProxy.Scheduling,
+	}
+	for i, c := range sc.Customs {
+		schedules[fmt.Sprintf("customs[%d]", i)] = c.Scheduling
+	}
+	for name, s := range schedules {
+		if s.Cost != nil && *s.Cost < 0 {
+			return fmt.Errorf("sourcesConfig.%s.cost must not be negative, got %d", name, *s.Cost)
+		}
+	}
+	return nil
+}
+
+// intPtr 返回指向 n 的指针，用于区分未配置与显式配置为 0 的字段
+func intPtr(n int) *int {
+	return &n
+}
+
+// intValue 返回指针指向的值，nil 时返回 0
+func intValue(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// validateFofa 校验 FOFA 数据源配置
+func validateFofa(fofa *types.FofaSource) error {
+	if fofa.Enabled && fofa.Key == "" {
+		return errors.New("sourcesConfig.fofa.key is required")
+	}
+	if fofa.PageSize < 0 || fofa.PageSize > 10000 {
+		return fmt.Errorf("sourcesConfig.fofa.pageSize must be between 1 and 10000, got %d", fofa.PageSize)
+	}
+	var hasIP, hasPort bool
+	for _, field := range fofa.Fields {
+		switch field {
+		case "ip":
+			hasIP = true
+		case "port":
+			hasPort = true
+		case "protocol":
+		default:
+			return fmt.Errorf("sourcesConfig.fofa.fields: unsupported field %q, expected ip, port or protocol", field)
+		}
+	}
+	if !hasIP || !hasPort {
+		return errors.New("sourcesConfig.fofa.fields must include ip and port")
+	}
+	return nil
+}
+
+// validateEngines 校验搜索引擎数据源配置，Shodan、ZoomEye 与 Censys 启用时必须配置凭据
+func validateEngines(sc *types.SourcesConfig) error {
+	if sc.Hunter.PageSize < 0 || sc.Hunter.PageSize > 100 {
+		return fmt.Errorf("sourcesConfig.hunter.pageSize must be between 1 and 100, got %d", sc.Hunter.PageSize)
+	}
+	if sc.Quake.PageSize < 0 || sc.Quake.PageSize > 500 {
+		return fmt.Errorf("sourcesConfig.quake.pageSize must be between 1 and 500, got %d", sc.Quake.PageSize)
+	}
+	if sc.Hunter.Days < 0 || sc.Quake.Days < 0 {
+		return errors.New("sourcesConfig.hunter.days and sourcesConfig.quake.days must not be negative")
+	}
+	budgets := map[string]types.Budget{
+		"hunter":  sc.Hunter.Budget,
+		"quake":   sc.Quake.Budget,
+		"fofa":    sc.Fofa.Budget,
+		"shodan":  sc.Shodan.Budget,
+		"zoomeye": sc.ZoomEye.Budget,
+		"censys":  sc.Censys.Budget,
+	}
+	for name, b := range budgets {
+		if b.DailyBudget < 0 || b.MonthlyBudget < 0 || b.PageDelay < 0 {
+			return fmt.Errorf("sourcesConfig.%s: dailyBudget, monthlyBudget and pageDelay must not be negative", name)
+		}
+	}
+	if sc.Shodan.Enabled && sc.Shodan.Key == "" {
+		return errors.New("sourcesConfig.shodan.key is required")
+	}
+	if sc.ZoomEye.Enabled && sc.ZoomEye.APIKey == "" {
+		return errors.New("sourcesConfig.zoomeye.apiKey is required")
+	}
+	if sc.ZoomEye.PageSize < 0 || sc.ZoomEye.PageSize > 10000 {
+		return fmt.Errorf("sourcesConfig.zoomeye.pageSize must be between 1 and 10000, got %d", sc.ZoomEye.PageSize)
+	}
+	if sc.Censys.Enabled && (sc.Censys.APIID == "" || sc.Censys.APISecret == "") {
+		return errors.New("sourcesConfig.censys.apiID and apiSecret are required")
+	}
+	if sc.Censys.PageSize < 0 || sc.Censys.PageSize > 100 {
+		return fmt.Errorf("sourcesConfig.censys.pageSize must be between 1 and 100, got %d", sc.Censys.PageSize)
+	}
+	return nil
+}
+
+// defaultCheckTimeouts 检测使用的默认超时
+func defaultCheckTimeouts(total int) *types.Timeouts {
+	return &types.Timeouts{
+		Connect:   5,
+		Handshake: 5,
+		TLS:       5,
+		FirstByte: 10,
+		Total:     total,
+	}
+}
+
+// defaultListenerTimeouts 实时拨号使用的默认超时
+func defaultListenerTimeouts() *types.Timeouts {
+	return &types.Timeouts{
+		Connect:   10,
+		Handshake: 10,
+	}
+}
+
+// fillTimeouts 用默认值补齐未配置的超时项
+func fillTimeouts(t *types.Timeouts, def *types.Timeouts) *types.Timeouts {
+	if t == nil {
+		return def
+	}
+	if t.Connect == 0 {
+		t.Connect = def.Connect
+	}
+	if t.Handshake == 0 {
+		t.Handshake = def.Handshake
+	}
+	if t.TLS == 0 {
+		t.TLS = def.TLS
+	}
+	if t.FirstByte == 0 {
+		t.FirstByte = def.FirstByte
+	}
+	if t.Total == 0 {
+		t.Total = def.Total
+	}
+	return t
 }
 
 // saveConfigToFile 原子化保存配置文件
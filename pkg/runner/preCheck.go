@@ -0,0 +1,199 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/metrics"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// 预检测的阶段名称
+const (
+	StageTCP       = "tcp"       // 第一阶段：TCP 连接
+	StageHandshake = "handshake" // 第二阶段：SOCKS5 问候与认证方法协商
+	StageConnect   = "connect"   // 第三阶段：CONNECT 到指定目标
+)
+
+const (
+	socks5Version        = 0x05
+	socks5AuthNone       = 0x00
+	socks5AuthPassword   = 0x02
+	socks5AuthNoAccept   = 0xff
+	socks5CmdConnect     = 0x01
+	socks5AtypIPv4       = 0x01
+	socks5AtypDomain     = 0x03
+	socks5AtypIPv6       = 0x04
+	socks5ReplySucceeded = 0x00
+)
+
+// StageResult 记录单个检测阶段的结果与耗时
+type StageResult struct {
+	Name     string        `json:"name"`            // 阶段名称 tcp/handshake/connect
+	OK       bool          `json:"ok"`              // 是否通过
+	Duration time.Duration `json:"duration"`        // 阶段耗时（纳秒）
+	Error    string        `json:"error,omitempty"` // 失败原因
+}
+
+// preCheck 对代理执行分阶段的轻量预检测，并把每个阶段的结果写回 proxyInfo
+// 未启用预检测或全部阶段通过时返回 nil，否则返回失败阶段的错误
+func (m *SocksProxyManager) preCheck(ctx context.Context, proxyInfo *ProxyInfo) error {
+	cfg := m.conf().CheckSock.PreCheck
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	start := time.Now()
+	stages, authRequired, err := runPreCheck(ctx, proxyInfo, m.resolvers.Load().check, cfg.ConnectTarget, m.conf().CheckSock.Timeouts)
+	metrics.ObserveCheck("precheck", start, err == nil, err)
+
+	m.mu.Lock()
+	proxyInfo.Stages = stages
+	proxyInfo.AuthRequired = authRequired
+	m.mu.Unlock()
+
+	if err != nil {
+		m.logger.Debugf("预检测失败: %s [%s] %s", proxyInfo.URL, stages[len(stages)-1].Name, err)
+	}
+	return err
+}
+
+// runPreCheck 依次执行 TCP 连接、SOCKS5 握手与 CONNECT 三个阶段，任一阶段失败即停止并返回该阶段的错误
+// CONNECT 目标的域名按 res 解析，res 为 nil 时交给代理解析
+func runPreCheck(ctx context.Context, proxyInfo *ProxyInfo, res *dns.Resolver, target string, timeouts *types.Timeouts) (stages []*StageResult, authRequired bool, err error) {
+	record := func(name string, start time.Time, err error) bool {
+		r := &StageResult{Name: name, OK: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		stages = append(stages, r)
+		return r.OK
+	}
+
+	// 1. TCP 连接
+	start := time.Now()
+	dialer := &net.Dialer{Timeout: seconds(timeouts.Connect)}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(proxyInfo.IP, strconv.Itoa(proxyInfo.Port)))
+	if !record(StageTCP, start, err) {
+		return stages, false, err
+	}
+	defer conn.Close()
+
+	// 2. SOCKS5 问候与方法协商（同时得出上游是否要求认证）
+	start = time.Now()
+	_ = conn.SetDeadline(time.Now().Add(seconds(timeouts.Handshake)))
+	authRequired, err = socks5Handshake(conn, proxyInfo.Username, proxyInfo.Password)
+	if !record(StageHandshake, start, err) {
+		return stages, authRequired, err
+	}
+
+	// 3. CONNECT 到配置的目标，proxy 模式经由同一个代理另建连接查询 DNS
+	start = time.Now()
+	if res != nil {
+		sd, _ := proxyInfo.NewDialer(dialer)
+		if target, err = res.ResolveAddr(ctx, target, sd.DialContext); err != nil {
+			record(StageConnect, start, err)
+			return stages, authRequired, err
+		}
+	}
+	_ = conn.SetDeadline(time.Now().Add(seconds(timeouts.Handshake)))
+	err = socks5Connect(conn, target)
+	record(StageConnect, start, err)
+	return stages, authRequired, err
+}
+
+// socks5Handshake 发送 SOCKS5 问候并完成方法协商，需要时执行用户名密码认证(RFC 1929)
+func socks5Handshake(conn net.Conn, username, password string) (authRequired bool, err error) {
+	// 同时提供 无认证 与 用户名密码 两种方法，由服务端选择
+	if _, err = conn.Write([]byte{socks5Version, 2, socks5AuthNone, socks5AuthPassword}); err != nil {
+		return false, err
+	}
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return false, err
+	}
+	if reply[0] != socks5Version {
+		return false, fmt.Errorf("unexpected socks version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+		return false, nil
+	case socks5AuthPassword:
+		if username == "" && password == "" {
+			return true, errors.New("upstream requires authentication")
+		}
+		if len(username) > 255 || len(password) > 255 {
+			return true, errors.New("username or password too long")
+		}
+		req := []byte{0x01, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err = conn.Write(req); err != nil {
+			return true, err
+		}
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return true, err
+		}
+		if reply[1] != 0x00 {
+			return true, errors.New("authentication rejected by upstream")
+		}
+		return true, nil
+	case socks5AuthNoAccept:
+		// 服务端既不接受无认证、也不接受用户名密码
+		return false, errors.New("no acceptable authentication methods")
+	default:
+		return false, fmt.Errorf("unsupported authentication method %d", reply[1])
+	}
+}
+
+// socks5Connect 发送 CONNECT 请求并检查应答码
+func socks5Connect(conn net.Conn, target string) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid connect target port %q", portStr)
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socks5AtypIPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socks5AtypIPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("connect target host too long")
+		}
+		req = append(req, socks5AtypDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unexpected socks version %d", header[0])
+	}
+	if header[1] != socks5ReplySucceeded {
+		return fmt.Errorf("connect rejected with reply code %d", header[1])
+	}
+	return nil
+}
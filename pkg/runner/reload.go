@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// reloadDebounce 配置文件连续变化时合并为一次加载的等待时间
+const reloadDebounce = 500 * time.Millisecond
+
+// WatchConfig 监听配置文件的变化与 SIGHUP 信号，重新解析并校验配置后交给 apply 应用
+// 配置无效或 apply 返回错误时保留当前配置；ctx 取消后停止监听
+func WatchConfig(ctx context.Context, opts *types.Options, apply func(cfg *types.ConfigOptions) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听所在目录而不是文件本身，编辑器保存时常以重命名方式替换文件
+	configPath, err := filepath.Abs(opts.ConfigPath)
+	if err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	reload := func(reason string) {
+		if _, err := os.Stat(opts.ConfigPath); err != nil {
+			gologger.Warning().Msgf("配置文件不可用，忽略本次重新加载: %v", err)
+			return
+		}
+		cfg, err := ParserConfigOptions(opts)
+		if err != nil {
+			gologger.Error().Msgf("配置无效，已拒绝本次修改并保留当前配置: %v", err)
+			return
+		}
+		if err := apply(cfg); err != nil {
+			gologger.Error().Msgf("应用配置失败，已保留当前配置: %v", err)
+			return
+		}
+		gologger.Info().Msgf("配置已重新加载 (%s)", reason)
+	}
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(hup)
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reload("SIGHUP")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != configPath {
+					continue
+				}
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+					debounce = time.After(reloadDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				reload("文件变化")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				gologger.Warning().Msgf("监听配置文件失败: %v", err)
+			}
+		}
+	}()
+	return nil
+}
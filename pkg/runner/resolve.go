@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"context"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"strings"
+)
+
+// resolvers 一份配置对应的域名解析器，热加载时整体替换
+// 解析器为 nil 表示把域名交给代理解析
+type resolvers struct {
+	listener *dns.Resolver            // 实时拨号默认使用
+	check    *dns.Resolver            // 检测使用，未配置时与监听相同
+	pools    map[string]*dns.Resolver // 配置了 dns 的命名代理池
+}
+
+// newResolvers 根据已校验的配置创建解析器
+func newResolvers(cfg *types.ConfigOptions) *resolvers {
+	rs := &resolvers{pools: make(map[string]*dns.Resolver)}
+	if cfg.Listener != nil {
+		rs.listener, _ = dns.New(cfg.Listener.DNS)
+	}
+	rs.check = rs.listener
+	if cfg.CheckSock != nil && cfg.CheckSock.DNS != nil {
+		rs.check, _ = dns.New(cfg.CheckSock.DNS)
+	}
+	for name, pool := range cfg.Pools {
+		if pool != nil && pool.DNS != nil {
+			rs.pools[name], _ = dns.New(pool.DNS)
+		}
+	}
+	return rs
+}
+
+// forPools 返回路由到命名代理池时使用的解析器，取第一个配置了 dns 的代理池，都未配置时与监听相同
+func (rs *resolvers) forPools(pools []string) *dns.Resolver {
+	for _, name := range pools {
+		if r, ok := rs.pools[name]; ok {
+			return r
+		}
+	}
+	return rs.listener
+}
+
+// resolveTarget 按解析方式处理经由 proxyInfo 拨号的目标地址，res 为 nil 时把域名交给代理解析
+// 使用监听的解析方式时，直接使用监听在本地解析得到的 IP，避免重复解析
+func (m *SocksProxyManager) resolveTarget(ctx context.Context, res *dns.Resolver, proxyInfo *ProxyInfo, timeouts *types.Timeouts, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	if res == m.resolvers.Load().listener {
+		if req := types.RequestFromContext(ctx); req != nil && req.IP != nil && strings.EqualFold(req.FQDN, host) {
+			return net.JoinHostPort(req.IP.String(), port), nil
+		}
+	}
+	if res == nil {
+		return addr, nil
+	}
+	return res.ResolveAddr(ctx, addr, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return m.dialVia(ctx, proxyInfo, timeouts, network, addr)
+	})
+}
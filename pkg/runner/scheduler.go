@@ -0,0 +1,283 @@
+package runner
+
+import (
+	"context"
+	"github.com/wjlin0/deadpool/pkg/source"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// schedulerMaxWait 调度器两次检查之间的最长等待，事件丢失或配置变化时也能在该时间内重新计划
+const schedulerMaxWait = time.Minute
+
+// yieldDecay 每次获取后之前产出的权重，排序使用的入池比例以最近的获取为主，一次失败的获取不会永久影响排序
+const yieldDecay = 0.5
+
+// 调度器为代理源计划下一次获取的原因
+const (
+	planPoolFull   = "pool is full"               // 代理池充足，低于 minSize 时再获取
+	planInterval   = "waiting for fetch interval" // 距上次获取不足 queryTimeout
+	planBackoff    = "backing off"                // 获取失败后的退避期间
+	planFetching   = "fetching"                   // 正在获取
+	planTargetDone = "target reached"             // 本轮已补充到目标数量
+)
+
+// fetchPlan 调度器为代理源计划的下一次获取
+type fetchPlan struct {
+	Next   time.Time // 计划获取的时间，代理池充足时为零值
+	Reason string
+}
+
+// sourceYield 代理源一次获取的产出：获取到的候选代理数与通过检测入池的代理数
+type sourceYield struct {
+	Fetched  int
+	Accepted int
+}
+
+// ratio 返回入池比例，从未获取过时返回 -1
+func (y sourceYield) ratio() float64 {
+	if y.Fetched == 0 {
+		return -1
+	}
+	return float64(y.Accepted) / float64(y.Fetched)
+}
+
+// decayedYield 按 yieldDecay 衰减的历史产出
+type decayedYield struct {
+	Fetched  float64
+	Accepted float64
+}
+
+// scheduler 代理源获取的调度状态：唤醒事件、每个源的计划、调度配置、最近一次、累计与衰减后的产出
+type scheduler struct {
+	wake      chan struct{} // 代理池数量变化或配置变化时唤醒
+	mu        sync.RWMutex
+	plans     map[string]fetchPlan
+	schedules map[string]types.Scheduling
+	yields    map[string]sourceYield
+	totals    map[string]sourceYield
+	decayed   map[string]decayedYield
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		wake:      make(chan struct{}, 1),
+		plans:     make(map[string]fetchPlan),
+		schedules: make(map[string]types.Scheduling),
+		yields:    make(map[string]sourceYield),
+		totals:    make(map[string]sourceYield),
+		decayed:   make(map[string]decayedYield),
+	}
+}
+
+// notify 唤醒调度器，已有未处理的唤醒时忽略
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) setPlan(name string, next time.Time, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plans[name] = fetchPlan{Next: next, Reason: reason}
+}
+
+func (s *scheduler) plan(name string) fetchPlan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.plans[name]
+}
+
+// setSchedules 替换所有代理源的调度配置，配置重新加载时调用
+func (s *scheduler) setSchedules(schedules map[string]types.Scheduling) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules = schedules
+}
+
+func (s *scheduler) schedule(name string) types.Scheduling {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schedules[name]
+}
+
+// recordYield 记录一次获取的产出，累加到历史产出并更新衰减后的产出
+func (s *scheduler) recordYield(name string, y sourceYield) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.yields[name] = y
+	t := s.totals[name]
+	t.Fetched += y.Fetched
+	t.Accepted += y.Accepted
+	s.totals[name] = t
+	d := s.decayed[name]
+	d.Fetched = d.Fetched*yieldDecay + float64(y.Fetched)
+	d.Accepted = d.Accepted*yieldDecay + float64(y.Accepted)
+	s.decayed[name] = d
+}
+
+func (s *scheduler) yield(name string) sourceYield {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.yields[name]
+}
+
+// total 返回代理源的历史累计产出
+func (s *scheduler) total(name string) sourceYield {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.totals[name]
+}
+
+// recentRatio 返回按衰减后的产出计算的入池比例，从未获取到候选代理时返回 -1
+func (s *scheduler) recentRatio(name string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d := s.decayed[name]
+	if d.Fetched == 0 {
+		return -1
+	}
+	return d.Accepted / d.Fetched
+}
+
+// costPerAccepted 按入池比例估算每得到一个可用代理的成本，免费的源总是 0，没有产出记录时按比例 1 估算，
+// 付费的源最近没有代理入池时为正无穷
+func costPerAccepted(cost int, ratio float64) float64 {
+	switch {
+	case cost == 0:
+		return 0
+	case ratio < 0:
+		return float64(cost)
+	case ratio == 0:
+		return math.Inf(1)
+	}
+	return float64(cost) / ratio
+}
+
+// notifyPool 代理池的存活数量可能变化时唤醒调度器
+func (m *SocksProxyManager) notifyPool() {
+	m.sched.notify()
+}
+
+// targetSize 返回补充代理池的目标数量，低于 minSize 时补充到 minSize + headroom
+func (m *SocksProxyManager) targetSize() int {
+	cs := m.conf().CheckSock
+	return cs.MinSize + intValue(cs.Headroom)
+}
+
+// nextFetch 返回代理源最早可以获取的时间与原因：距上次获取满 queryTimeout(分钟)且不在失败退避期间
+func nextFetch(s source.Source) (time.Time, string) {
+	next := s.LastFetchTime().Add(time.Duration(s.QueryTimeout()) * time.Minute)
+	reason := planInterval
+	if retry := s.Status().NextRetry; retry.After(next) {
+		next, reason = retry, planBackoff
+	}
+	return next, reason
+}
+
+// sourceRank 代理源的排序依据
+type sourceRank struct {
+	priority int
+	cost     float64 // 每得到一个可用代理的预计成本
+	ratio    float64
+}
+
+// orderedSources 返回按获取顺序排列的代理源：priority 小的优先，其次每个可用代理的预计成本低的优先，最后最近的入池比例高的优先
+// 从未获取过的源入池比例视为最高，确保每个源至少被尝试一次
+func (m *SocksProxyManager) orderedSources() []source.Source {
+	sources := m.Sources()
+	ranks := make(map[string]sourceRank, len(sources))
+	for _, s := range sources {
+		sched := m.sched.schedule(s.Name())
+		r := m.sched.recentRatio(s.Name())
+		rank := sourceRank{priority: sched.Priority, cost: costPerAccepted(intValue(sched.Cost), r), ratio: r}
+		if r < 0 {
+			rank.ratio = 2
+		}
+		ranks[s.Name()] = rank
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		a, b := ranks[sources[i].Name()], ranks[sources[j].Name()]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		if a.cost != b.cost {
+			return a.cost < b.cost
+		}
+		return a.ratio > b.ratio
+	})
+	return sources
+}
+
+// StartAutoSource 代理池不足时自动从代理源获取代理，ctx 取消后退出
+// 调度器在代理池数量变化与代理源可以获取时被唤醒，存活数量低于 minSize 时按 orderedSources 的顺序逐个获取，
+// 前一个源获取后仍未达到 minSize + headroom 时才获取下一个
+func (m *SocksProxyManager) StartAutoSource(ctx context.Context) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			timer := time.NewTimer(m.topUp(ctx))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-m.sched.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}()
+}
+
+// topUp 代理池不足时按顺序从可以获取的代理源补充，返回距下一次需要检查的时间
+func (m *SocksProxyManager) topUp(ctx context.Context) time.Duration {
+	sources := m.orderedSources()
+	if m.AliveProxy() >= m.conf().CheckSock.MinSize {
+		for _, s := range sources {
+			m.sched.setPlan(s.Name(), time.Time{}, planPoolFull)
+		}
+		return schedulerMaxWait
+	}
+
+	wait := schedulerMaxWait
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			return wait
+		}
+		now := time.Now()
+		if next, reason := nextFetch(s); next.After(now) {
+			m.sched.setPlan(s.Name(), next, reason)
+			if d := next.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+		target := m.targetSize()
+		if m.AliveProxy() >= target {
+			m.sched.setPlan(s.Name(), time.Time{}, planTargetDone)
+			continue
+		}
+
+		m.sched.setPlan(s.Name(), now, planFetching)
+		m.logger.Infof("代理池存活数量 %d 低于目标 %d，从 %s 获取代理", m.AliveProxy(), target, s.Name())
+		y := m.fetchSource(ctx, s, target)
+		m.sched.recordYield(s.Name(), y)
+
+		next, reason := nextFetch(s)
+		m.sched.setPlan(s.Name(), next, reason)
+		if d := time.Until(next); d < wait {
+			wait = d
+		}
+	}
+	// 至少等待一秒，避免所有源都刚好到期时空转
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
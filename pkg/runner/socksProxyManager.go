@@ -2,25 +2,24 @@ package runner
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/peakedshout/go-socks"
-	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/retryablehttp-go"
-	"github.com/remeh/sizedwaitgroup"
+	"github.com/tidwall/gjson"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/metrics"
 	"github.com/wjlin0/deadpool/pkg/source"
 	"github.com/wjlin0/deadpool/pkg/types"
 	"io"
-	"log"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,6 +35,12 @@ type ProxyInfo struct {
 	Password    string        `json:"password,omitempty"` // 认证密码（建议在前端脱敏）
 	Source      string        `json:"source,omitempty"`   // 代理来源标识（如：file/hunter/quake）
 	ExitIP      string        `json:"exit_ip,omitempty"`  // 出口IP（通过代理访问外部服务时显示的IP）
+	Country     string        `json:"country,omitempty"`  // 出口所在国家（来自地理位置检测的响应）
+	Disabled    bool          `json:"disabled,omitempty"` // 是否被手动停用，停用后不参与轮询
+	Pinned      bool          `json:"pinned,omitempty"`   // 是否被手动固定，存在可用的固定代理时只在固定代理中轮询
+
+	AuthRequired bool           `json:"auth_required,omitempty"` // 上游是否要求认证（由预检测握手阶段得出）
+	Stages       []*StageResult `json:"stages,omitempty"`        // 最近一次分阶段预检测的结果
 }
 
 type IPGeoResponse struct {
@@ -44,49 +49,78 @@ type IPGeoResponse struct {
 
 // SocksProxyManager 管理SOCKS代理
 type SocksProxyManager struct {
-	config       *types.ConfigOptions
-	proxyMap     map[string]*ProxyInfo // 使用URL作为key的map
+	config       atomic.Pointer[types.ConfigOptions] // 当前配置，热加载时整体替换
+	proxyMap     map[string]*ProxyInfo               // 使用URL作为key的map
 	mu           sync.RWMutex
 	lastProxyURL string
 	sources      []source.Source
+	fingerprints map[string]string                    // 代理源名称 -> 配置指纹
+	watches      map[source.Source]context.CancelFunc // 正在监听变化的代理源
+	srcMu        sync.RWMutex                         // 保护 sources、fingerprints 与 watches
+	limiter      *checkLimiter                        // 后台检测的并发控制
+	events       *eventHub                            // 实时拨号的连接事件
+	sched        *scheduler                           // 代理源获取的调度状态
+	resolvers    atomic.Pointer[resolvers]
+	credits      *source.CreditStore // 搜索引擎数据源的积分用量与翻页进度
+	logger       types.Logger
+
+	ctx     context.Context    // 后台循环的上下文，Close 时取消
+	cancel  context.CancelFunc // 取消所有后台循环
+	wg      sync.WaitGroup     // 等待后台循环退出
+	closeMu sync.Mutex         // 保护 closed，保证 Close 开始等待后不再有新的任务计入 wg
+	closed  bool
 }
 
 // NewSocksProxyManager 创建新的代理管理器
 func NewSocksProxyManager(cfg *types.ConfigOptions) *SocksProxyManager {
 	spm := &SocksProxyManager{
-		config:   cfg,
 		proxyMap: make(map[string]*ProxyInfo),
-	}
-	var sources []source.Source
-	// 初始化 文件源
-	if cfg.SourcesConfig.File.Enabled {
-		sources = append(sources, source.NewFileSource(cfg.SourcesConfig.File.Path, cfg.SourcesConfig.File.QueryTimeout))
-	}
-	if cfg.SourcesConfig.Hunter.Enabled {
-		sources = append(sources, source.NewHunterSource(cfg.SourcesConfig.Hunter.APIKey, cfg.SourcesConfig.Hunter.Endpoint, cfg.SourcesConfig.Hunter.Query, cfg.SourcesConfig.Hunter.MaxSize, cfg.SourcesConfig.Hunter.QueryTimeout))
-	}
+		limiter:  newCheckLimiter(cfg.CheckSock.MinConcurrentReq, cfg.CheckSock.MaxConcurrentReq, cfg.CheckSock.Adaptive, cfg.CheckSock.TimeoutRatio),
+		events:   newEventHub(),
+		sched:    newScheduler(),
+		logger:   types.DefaultLogger(),
+		ctx:      context.Background(),
+	}
+	spm.config.Store(cfg)
+	spm.resolvers.Store(newResolvers(cfg))
+	spm.credits = newCreditStore(cfg, spm.logger)
+	var schedules map[string]types.Scheduling
+	spm.sources, spm.fingerprints, schedules = spm.buildSources(cfg)
+	spm.sched.setSchedules(schedules)
+	return spm
+}
 
-	if cfg.SourcesConfig.CheckerProxy.Enabled {
-		sources = append(sources, source.NewCheckerProxySource(cfg.SourcesConfig.CheckerProxy.Endpoint, cfg.SourcesConfig.CheckerProxy.QueryTimeout))
-	}
-	if cfg.SourcesConfig.Quake.Enabled {
-		sources = append(sources, source.NewQuakeSource(cfg.SourcesConfig.Quake.APIKey, cfg.SourcesConfig.Quake.Endpoint, cfg.SourcesConfig.Quake.Query, cfg.SourcesConfig.Quake.MaxSize, cfg.SourcesConfig.Quake.QueryTimeout))
-	}
-	if cfg.SourcesConfig.Customs != nil && len(cfg.SourcesConfig.Customs) > 0 {
-		for i, custom := range cfg.SourcesConfig.Customs {
-			sources = append(sources, source.NewCustomSource(fmt.Sprintf("custom-%d", i+1), custom.Endpoint, custom.Method, custom.Headers, custom.Body, custom.Extract, custom.ResponseType, custom.QueryTimeout, custom.EnablePaging, custom.MaxSize))
-		}
+// SetLogger 设置管理器及所有代理源使用的日志实现，需在 Run 之前调用
+func (m *SocksProxyManager) SetLogger(logger types.Logger) {
+	m.logger = logger
+	for _, s := range m.Sources() {
+		s.SetLogger(logger)
 	}
+}
 
-	spm.sources = sources
-	return spm
+// conf 返回当前配置
+func (m *SocksProxyManager) conf() *types.ConfigOptions {
+	return m.config.Load()
 }
 
-// NewSocksProxyManagerWithFile 从文件创建代理管理器
-func NewSocksProxyManagerWithFile(cfg *types.ConfigOptions, filename string) (*SocksProxyManager, error) {
+// Config 返回当前生效的配置，热加载后返回新配置
+func (m *SocksProxyManager) Config() *types.ConfigOptions {
+	return m.conf()
+}
+
+// aliveDataPath 返回存活代理的持久化文件路径，未配置时返回空
+func (m *SocksProxyManager) aliveDataPath() string {
+	if m.conf().Options == nil {
+		return ""
+	}
+	return m.conf().Options.AliveDataPath
+}
+
+// NewSocksProxyManagerWithFile 从文件创建代理管理器，加载时会重新检测文件中的代理，ctx 取消后停止检测并返回 ctx 的错误
+func NewSocksProxyManagerWithFile(ctx context.Context, cfg *types.ConfigOptions, filename string) (*SocksProxyManager, error) {
 
 	m := NewSocksProxyManager(cfg)
-	if err := m.LoadFromFile(filename); err != nil {
+	if err := m.LoadFromFileContext(ctx, filename); err != nil {
 		return nil, err
 	}
 
@@ -118,6 +152,11 @@ func (p *ProxyInfo) NewDialer(baseDialer socks.Dialer) (sd socks.Dialer, err err
 
 // NextProxy 获取下一个可用代理(轮询方式)
 func (m *SocksProxyManager) NextProxy() *ProxyInfo {
+	return m.nextProxy(nil)
+}
+
+// nextProxy 在符合 match 的代理中获取下一个可用代理，match 为 nil 时不筛选
+func (m *SocksProxyManager) nextProxy(match func(p *ProxyInfo) bool) *ProxyInfo {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -125,11 +164,19 @@ func (m *SocksProxyManager) NextProxy() *ProxyInfo {
 		return nil
 	}
 
-	// 创建一个有序的URL列表用于轮询
-	var urls []string
-	for u := range m.proxyMap {
-
+	// 创建一个有序的URL列表用于轮询，存在可用的固定代理时只在固定代理中轮询
+	var urls, pinned []string
+	for u, p := range m.proxyMap {
+		if p.Disabled || (match != nil && !match(p)) {
+			continue
+		}
 		urls = append(urls, u)
+		if p.Pinned && p.IsAlive {
+			pinned = append(pinned, u)
+		}
+	}
+	if len(pinned) > 0 {
+		urls = pinned
 	}
 
 	// 查找上次返回的位置
@@ -174,7 +221,7 @@ func (m *SocksProxyManager) AddProxies(proxyURLs []string, s string) {
 				return
 			}
 			// 进行存活检测
-			isAlive, latency := m.checkProxyAlive(context.Background(), proxyInfo)
+			isAlive, latency, _ := m.checkProxyAlive(m.ctx, proxyInfo)
 			proxyInfo.IsAlive = isAlive
 			proxyInfo.Latency = latency
 
@@ -196,19 +243,38 @@ func (m *SocksProxyManager) AddProxiesWithAutoSave(proxyURLs []string, filename
 	return m.SaveToFile(filename)
 }
 
-// StartAutoSave 启动定期自动保存
-func (m *SocksProxyManager) StartAutoSave() {
-	ticker := time.NewTicker(5)
+// StartAutoSave 启动定期自动保存，ctx 取消后退出
+func (m *SocksProxyManager) StartAutoSave(ctx context.Context) {
+	filename := m.aliveDataPath()
+	if filename == "" {
+		return
+	}
+	ticker := time.NewTicker(5 * time.Second)
 
+	m.wg.Add(1)
 	go func() {
-		for range ticker.C {
-			m.SaveToFile(m.config.Options.AliveDataPath)
+		defer m.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.SaveToFile(filename); err != nil {
+					m.logger.Warningf("保存存活代理失败: %v", err)
+				}
+			}
 		}
 	}()
 }
 
-// LoadFromFile 从JSON文件加载代理信息，处理文件不存在的情况
+// LoadFromFile 从JSON文件加载代理信息，处理文件不存在的情况，Run 之后调用时随 Close 停止检测
 func (m *SocksProxyManager) LoadFromFile(filename string) error {
+	return m.LoadFromFileContext(m.ctx, filename)
+}
+
+// LoadFromFileContext 同 LoadFromFile，ctx 取消后停止检测剩余的代理并返回 ctx 的错误
+func (m *SocksProxyManager) LoadFromFileContext(ctx context.Context, filename string) error {
 	// 检查文件是否存在
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		// 文件不存在，创建空文件
@@ -245,19 +311,27 @@ func (m *SocksProxyManager) LoadFromFile(filename string) error {
 	}
 
 	// 将解析的数据复制到proxyMap
-	wg := sizedwaitgroup.New(m.config.CheckSock.MaxConcurrentReq)
+	var wg sync.WaitGroup
 
 	for u, pi := range proxyInfos {
-		wg.Add()
+		if err := m.limiter.Acquire(ctx); err != nil {
+			break
+		}
+		wg.Add(1)
 		// 确保URL与key一致
 		go func() {
 			defer wg.Done()
-			m.AddProxy(context.Background(), u, pi.Source)
+			accepted, err := m.addProxy(ctx, u, pi.Source)
+			m.limiter.Release(isTimeout(err))
+			// 恢复保存的停用与固定状态
+			if accepted && (pi.Disabled || pi.Pinned) {
+				m.update(u, func(p *ProxyInfo) { p.Disabled, p.Pinned = pi.Disabled, pi.Pinned })
+			}
 		}()
 	}
 	wg.Wait()
 
-	return nil
+	return ctx.Err()
 }
 
 // SaveToFile 将代理信息以JSON格式保存到文件，确保原子性写入
@@ -310,130 +384,73 @@ func tryRepairJSON(data []byte) ([]byte, bool) {
 	return nil, false
 }
 
-// checkProxyAlive 检测SOCKS5代理是否存活
-func (m *SocksProxyManager) checkProxyAlive(ctx context.Context, proxyInfo *ProxyInfo) (bool, time.Duration) {
-	timeout := time.Duration(m.config.CheckSock.CheckInterval) * time.Second
+// checkProxyAlive 检测SOCKS5代理是否存活，不存活时同时返回最后一次遇到的错误
+func (m *SocksProxyManager) checkProxyAlive(ctx context.Context, proxyInfo *ProxyInfo) (alive bool, latency time.Duration, err error) {
+	defer func(start time.Time) { metrics.ObserveCheck("alive", start, alive, err) }(time.Now())
+	timeouts := m.conf().CheckSock.Timeouts
 	start := time.Now()
-	// 1. 创建SOCKS5拨号器
-	baseDialer := &net.Dialer{
-		Timeout:   timeout,
-		KeepAlive: timeout,
-	}
-
-	sd, _ := proxyInfo.NewDialer(baseDialer)
-
-	// 2. 创建HTTP客户端
-	// 3. 发起请求
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			DisableKeepAlives: false, // 确保这是false
-			// 禁用连接复用
-			ForceAttemptHTTP2: false, // 禁用 HTTP/2
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			DialContext: func(_ctx context.Context, network, addr string) (net.Conn, error) {
-				return sd.DialContext(ctx, network, addr) // 代理解析目标地址
-			},
-			//Proxy: func(req *http.Request) (*url.URL, error) {
-			//	return url.Parse(proxyInfo.URL)
-			//},
-		},
-		//Timeout: timeout,
-	}
-	defaultOptions := retryablehttp.DefaultOptionsSingle
-	defaultOptions.HttpClient = httpClient
-	defaultOptions.Timeout = timeout
-	defaultOptions.RetryWaitMax = timeout
-	defaultOptions.RetryMax = 0
-	client := retryablehttp.NewClient(defaultOptions)
+	// 1. 创建经由代理的HTTP客户端
+	client := newCheckClient(ctx, proxyInfo, m.resolvers.Load().check, timeouts, seconds(timeouts.Total))
 
 	// 4. 发送请求到检查URL
-	if len(m.config.CheckSock.CheckRspKeywords) > 0 {
-		for _, u := range m.config.CheckSock.CheckURL {
+	var lastErr error
+	if len(m.conf().CheckSock.CheckRspKeywords) > 0 {
+		for _, u := range m.conf().CheckSock.CheckURL {
 			start = time.Now()
 			resp, err := client.Get(u)
 			if err != nil {
-				gologger.Error().Msgf("%s:%s", proxyInfo.URL, err.Error())
+				m.logger.Errorf("%s:%s", proxyInfo.URL, err.Error())
+				lastErr = err
 				continue
 			}
 			defer resp.Body.Close()
-			//gologger.Info().Msgf("%s -> %s %s", proxyInfo.URL, u, resp.Status)
+			//m.logger.Infof("%s -> %s %s", proxyInfo.URL, u, resp.Status)
 
 			// 5. 检查关键词 (如果配置了)
-			if len(m.config.CheckSock.CheckRspKeywords) != 0 {
+			if len(m.conf().CheckSock.CheckRspKeywords) != 0 {
 				body, err := io.ReadAll(resp.Body)
 				if err != nil {
+					lastErr = err
 					continue
 				}
 
-				for _, keyword := range m.config.CheckSock.CheckRspKeywords {
+				for _, keyword := range m.conf().CheckSock.CheckRspKeywords {
 					if keyword == "" {
-						return true, time.Since(start)
+						return true, time.Since(start), nil
 					}
 					if strings.Contains(string(body), keyword) {
-						return true, time.Since(start)
+						return true, time.Since(start), nil
 					}
 				}
+				lastErr = fmt.Errorf("%s: response keywords not matched", u)
 				continue
 			}
 
-			return true, time.Since(start)
+			return true, time.Since(start), nil
 		}
 	} else {
-		return true, time.Since(start)
+		return true, time.Since(start), nil
 	}
-	return false, time.Since(start)
+	return false, time.Since(start), lastErr
 }
 
-func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *ProxyInfo) bool {
+func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *ProxyInfo) (ok bool) {
 	// 1. 检查功能开关
-	if !m.config.CheckGeolocate.Enabled {
+	if !m.conf().CheckGeolocate.Enabled {
 		return true
 	}
-	timeout := time.Duration(m.config.CheckGeolocate.CheckInterval) * time.Second
-
-	baseDialer := &net.Dialer{
-		Timeout:   timeout,
-		KeepAlive: timeout,
+	defer func(start time.Time) { metrics.ObserveCheck("geolocate", start, ok, nil) }(time.Now())
+	// 地理位置检测沿用检测的分阶段超时，checkInterval 配置时作为总超时
+	timeouts := m.conf().CheckSock.Timeouts
+	total := seconds(timeouts.Total)
+	if m.conf().CheckGeolocate.CheckInterval > 0 {
+		total = seconds(m.conf().CheckGeolocate.CheckInterval)
 	}
 
-	sd, _ := proxyInfo.NewDialer(baseDialer)
-
 	// 2. 创建代理客户端
-	//dialer, err := proxy.SOCKS5("tcp",
-	//	net.JoinHostPort(proxyInfo.IP, strconv.Itoa(proxyInfo.Port)),
-	//	&proxy.Auth{
-	//		User:     proxyInfo.Username,
-	//		Password: proxyInfo.Password,
-	//	},
-	//	&net.Dialer{Timeout: timeout})
-	//if err != nil {
-	//	gologger.Warning().Msgf("%s : %s", proxyInfo.URL, err)
-	//	return false
-	//}
-
-	// 3. 发起请求
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			ForceAttemptHTTP2: false,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			DialContext: func(_ctx context.Context, network string, address string) (net.Conn, error) {
-				return sd.DialContext(ctx, network, address)
-			},
-		},
-		Timeout: timeout,
-	}
-	defaultOptions := retryablehttp.DefaultOptionsSingle
-	defaultOptions.HttpClient = httpClient
-	defaultOptions.Timeout = timeout
-	defaultOptions.RetryWaitMax = timeout
-	defaultOptions.RetryMax = 0
-	client := retryablehttp.NewClient(defaultOptions)
+	client := newCheckClient(ctx, proxyInfo, m.resolvers.Load().check, timeouts, total)
 	//client := httpClient
-	for _, u := range m.config.CheckGeolocate.CheckURL {
+	for _, u := range m.conf().CheckGeolocate.CheckURL {
 		//req, _ := http.NewRequest("GET", u, nil)
 		req, _ := retryablehttp.NewRequest("GET", u, nil)
 		req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/137.0.0.0 Safari/537.36")
@@ -441,24 +458,24 @@ func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *Proxy
 		resp, err := client.Do(req)
 
 		if err != nil {
-			gologger.Warning().Msgf("%s : %s", proxyInfo.URL, err)
+			m.logger.Warningf("%s : %s", proxyInfo.URL, err)
 
 			continue
 		}
 		defer resp.Body.Close()
-		//gologger.Info().Msg(fmt.Sprintf("%s -> %s %s", proxyInfo.URL, u, resp.Status))
+		//m.logger.Infof("%s -> %s %s", proxyInfo.URL, u, resp.Status)
 		// 4. 读取响应
 		body, _ := io.ReadAll(resp.Body) // 不处理读取错误，失败即返回false
 		responseText := string(body)
 
 		// 5. 执行关键词检查
 		// 5. 执行关键词检查
-		if len(m.config.CheckGeolocate.IncludeKeywords) > 0 {
+		if len(m.conf().CheckGeolocate.IncludeKeywords) > 0 {
 			includeMatched := false
-			if strings.ToLower(m.config.CheckGeolocate.IncludeKeywordCondition) == "and" {
+			if strings.ToLower(m.conf().CheckGeolocate.IncludeKeywordCondition) == "and" {
 				// AND 逻辑：必须匹配所有包含关键词
 				includeMatched = true
-				for _, kw := range m.config.CheckGeolocate.IncludeKeywords {
+				for _, kw := range m.conf().CheckGeolocate.IncludeKeywords {
 					if !strings.Contains(responseText, kw) {
 						includeMatched = false
 						break
@@ -466,7 +483,7 @@ func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *Proxy
 				}
 			} else {
 				// 默认 OR 逻辑：匹配任一包含关键词
-				for _, kw := range m.config.CheckGeolocate.IncludeKeywords {
+				for _, kw := range m.conf().CheckGeolocate.IncludeKeywords {
 					if strings.Contains(responseText, kw) {
 						includeMatched = true
 						break
@@ -478,12 +495,12 @@ func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *Proxy
 			}
 		}
 
-		if len(m.config.CheckGeolocate.ExcludeKeywords) > 0 {
+		if len(m.conf().CheckGeolocate.ExcludeKeywords) > 0 {
 			excludeMatched := false
-			if strings.ToLower(m.config.CheckGeolocate.ExcludeKeywordCondition) == "and" {
+			if strings.ToLower(m.conf().CheckGeolocate.ExcludeKeywordCondition) == "and" {
 				// AND 逻辑：必须匹配所有排除关键词才排除
 				excludeMatched = true
-				for _, kw := range m.config.CheckGeolocate.ExcludeKeywords {
+				for _, kw := range m.conf().CheckGeolocate.ExcludeKeywords {
 					if !strings.Contains(responseText, kw) {
 						excludeMatched = false
 						break
@@ -491,7 +508,7 @@ func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *Proxy
 				}
 			} else {
 				// 默认 OR 逻辑：匹配任一排除关键词就排除
-				for _, kw := range m.config.CheckGeolocate.ExcludeKeywords {
+				for _, kw := range m.conf().CheckGeolocate.ExcludeKeywords {
 					if strings.Contains(responseText, kw) {
 						excludeMatched = true
 						break
@@ -508,10 +525,16 @@ func (m *SocksProxyManager) checkGeolocate(ctx context.Context, proxyInfo *Proxy
 		if err := json.Unmarshal([]byte(responseText), &result); err != nil {
 			return false
 		}
+		// 不同接口的国家字段位置不同：ipapi.co 为 country，百度为 data.country
+		country := gjson.Get(responseText, "country").String()
+		if country == "" {
+			country = gjson.Get(responseText, "data.country").String()
+		}
 
 		m.mu.Lock()
 		defer m.mu.Unlock()
 		proxyInfo.ExitIP = result.IP
+		proxyInfo.Country = country
 		return true
 	}
 	return false
@@ -524,43 +547,98 @@ func (m *SocksProxyManager) Dial(network, addr string) (net.Conn, error) {
 // DialContext 简化的拨号实现，不自动标记代理状态
 // DialContext 完全支持上下文的实现
 func (m *SocksProxyManager) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return m.dialNext(ctx, nil, m.resolvers.Load().listener, network, addr)
+}
+
+// DialPool 通过指定的命名代理池中的代理建立连接，pools 为空时使用整个代理池，多个代理池时使用它们的并集
+func (m *SocksProxyManager) DialPool(ctx context.Context, pools []string, network, addr string) (net.Conn, error) {
+	if len(pools) == 0 {
+		return m.dialNext(ctx, nil, m.resolvers.Load().listener, network, addr)
+	}
+	configured := m.conf().Pools
+	selected := make([]*types.Pool, 0, len(pools))
+	for _, name := range pools {
+		pool, ok := configured[name]
+		if !ok || pool == nil {
+			return nil, fmt.Errorf("%w: %s", ErrPoolNotFound, name)
+		}
+		selected = append(selected, pool)
+	}
+	return m.dialNext(ctx, func(p *ProxyInfo) bool {
+		for _, pool := range selected {
+			if poolContains(pool, p) {
+				return true
+			}
+		}
+		return false
+	}, m.resolvers.Load().forPools(pools), network, addr)
+}
+
+// DialUpstream 通过指定的上游代理建立连接，上游不需要在代理池中
+func (m *SocksProxyManager) DialUpstream(ctx context.Context, proxyURL, network, addr string) (net.Conn, error) {
+	proxyInfo, err := parseProxyURL(proxyURL, "upstream")
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := m.Proxy(proxyInfo.URL); ok {
+		proxyInfo = p // 在代理池中时使用检测得到的出口IP
+	}
+	m.limiter.LiveBegin()
+	defer m.limiter.LiveEnd()
+	return m.dialThrough(ctx, time.Now(), m.resolvers.Load().listener, proxyInfo, network, addr)
+}
+
+// dialNext 通过下一个符合 match 的可用代理建立连接，目标域名按 res 解析
+func (m *SocksProxyManager) dialNext(ctx context.Context, match func(p *ProxyInfo) bool, res *dns.Resolver, network, addr string) (net.Conn, error) {
+	// 实时流量优先：拨号期间后台检测让出并发额度
+	m.limiter.LiveBegin()
+	defer m.limiter.LiveEnd()
+
+	start := time.Now()
 	// 1. 获取代理
-	proxyInfo := m.NextProxy()
+	proxyInfo := m.nextProxy(match)
 	if proxyInfo == nil {
-		log.Println("连接失败：没有可用代理")
-		return nil, fmt.Errorf("no available proxies")
+		m.logger.Warningf("连接失败：没有可用代理")
+		err := fmt.Errorf("no available proxies")
+		m.events.publish(ConnEvent{Time: start, Target: addr, Error: err.Error()})
+		return nil, err
 	}
+	return m.dialThrough(ctx, start, res, proxyInfo, network, addr)
+}
 
-	// 2. 创建拨号器
-	baseDialer := &net.Dialer{
-		Timeout:   time.Duration(m.config.CheckSock.CheckInterval)*time.Second + proxyInfo.Latency,
-		KeepAlive: 30 * time.Second,
+// dialThrough 通过指定的代理建立连接，目标域名按 res 解析，记录连接事件并把选中的上游告知调用方
+func (m *SocksProxyManager) dialThrough(ctx context.Context, start time.Time, res *dns.Resolver, proxyInfo *ProxyInfo, network, addr string) (net.Conn, error) {
+	event := ConnEvent{
+		Time:   start,
+		Proxy:  net.JoinHostPort(proxyInfo.IP, strconv.Itoa(proxyInfo.Port)),
+		Target: addr,
+	}
+	// 告知调用方选中的上游，供访问日志记录
+	if info := types.DialInfoFromContext(ctx); info != nil {
+		info.Upstream, info.ExitIP = event.Proxy, m.getExitIP(proxyInfo)
 	}
 
-	// 3. 创建SOCKS5拨号器
-
-	sd, _ := proxyInfo.NewDialer(baseDialer)
+	// 2. 按解析方式处理目标域名
+	timeouts := m.conf().Listener.Timeouts
+	target, err := m.resolveTarget(ctx, res, proxyInfo, timeouts, addr)
 
-	// 4. 尝试连接
+	// 3. 尝试连接
 	var conn net.Conn
-	var err error
-	if cd, ok := sd.(interface {
-		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
-	}); ok {
-		conn, err = cd.DialContext(ctx, network, addr)
-	} else {
-		conn, err = m.dialWithContext(ctx, sd, network, addr)
+	if err == nil {
+		conn, err = m.dialVia(ctx, proxyInfo, timeouts, network, target)
 	}
 
 	format := ""
 	var args []interface{}
 
-	// 5. 记录连接结果
+	// 5. 记录连接结果（每个连接的完整记录见访问日志，这里仅在调试时输出）
 	if err != nil {
 		format = "error -> %s -> %v"
 		args = append(args, proxyInfo.URL)
 		args = append(args, err)
-		gologger.Info().Msgf(format, args...)
+		m.logger.Debugf(format, args...)
+		event.Latency, event.Error = time.Since(start), err.Error()
+		m.events.publish(event)
 		return nil, err
 	} else {
 		exitIP := m.getExitIP(proxyInfo)
@@ -570,12 +648,32 @@ func (m *SocksProxyManager) DialContext(ctx context.Context, network, addr strin
 		args = append(args, remoteAddr)
 		args = append(args, localAddr)
 		args = append(args, exitIP)
-		gologger.Info().Msgf(format, args...)
+		m.logger.Debugf(format, args...)
+		event.Latency, event.Success, event.ExitIP = time.Since(start), true, exitIP
+		m.events.publish(event)
 	}
 
 	return conn, err
 }
 
+// dialVia 通过指定的代理建立连接，TCP 连接与 SOCKS5 握手整体受 dialTimeout 约束
+func (m *SocksProxyManager) dialVia(ctx context.Context, proxyInfo *ProxyInfo, timeouts *types.Timeouts, network, addr string) (net.Conn, error) {
+	baseDialer := &net.Dialer{
+		Timeout:   seconds(timeouts.Connect),
+		KeepAlive: 30 * time.Second,
+	}
+	sd, _ := proxyInfo.NewDialer(baseDialer)
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout(timeouts))
+	defer cancel()
+	if cd, ok := sd.(interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	}); ok {
+		return cd.DialContext(dialCtx, network, addr)
+	}
+	return m.dialWithContext(dialCtx, sd, network, addr)
+}
+
 // 辅助方法：获取出口IP
 func (m *SocksProxyManager) getExitIP(proxyInfo *ProxyInfo) string {
 	if proxyInfo.ExitIP != "" {
@@ -648,76 +746,133 @@ func parseProxyURL(proxyURL string, s string) (*ProxyInfo, error) {
 	}, nil
 }
 
+// AddProxy 检测代理并在可用时加入代理池
 func (m *SocksProxyManager) AddProxy(ctx context.Context, proxyURL string, s string) {
+	_, _ = m.addProxy(ctx, proxyURL, s)
+}
+
+// addProxy 同 AddProxy，返回代理是否通过检测入池，以及检测过程中遇到的错误，供并发控制判断是否超时
+func (m *SocksProxyManager) addProxy(ctx context.Context, proxyURL string, s string) (bool, error) {
 
 	// 判断 源是否存在 是否在 proxyMap 中
 	m.mu.RLock()
 	proxyInfo, ok := m.proxyMap[proxyURL]
 	if ok && proxyInfo.IsAlive {
 		m.mu.RUnlock()
-		return
+		return false, nil
 	}
 	m.mu.RUnlock()
 
 	proxyInfo, err := parseProxyURL(proxyURL, s)
 	if err != nil {
-		return
+		return false, nil
+	}
+
+	// 先做廉价的分阶段预检测，未通过的不再进行完整检测
+	if err := m.preCheck(ctx, proxyInfo); err != nil {
+		return false, err
 	}
 
 	if !m.checkGeolocate(ctx, proxyInfo) {
-		return
+		return false, nil
 	}
 
-	isAlive, latency := m.checkProxyAlive(ctx, proxyInfo)
+	isAlive, latency, err := m.checkProxyAlive(ctx, proxyInfo)
 	proxyInfo.IsAlive = isAlive
 	proxyInfo.Latency = latency
 	proxyInfo.LastChecked = time.Now()
-	// 如果超过 5秒的延迟 就不要了
-
-	if isAlive && latency < 5*time.Second {
-		gologger.Info().Msgf("代理可用: %s", proxyInfo.URL)
+	// 超过代理池允许的最大延迟就不要了
+	if isAlive && m.acceptLatency(latency) {
+		m.logger.Infof("代理可用: %s", proxyInfo.URL)
 		m.mu.Lock()
+		// 保留手动设置的停用与固定状态
+		if old, ok := m.proxyMap[proxyInfo.URL]; ok {
+			proxyInfo.Disabled, proxyInfo.Pinned = old.Disabled, old.Pinned
+		}
 		m.proxyMap[proxyInfo.URL] = proxyInfo
 		m.mu.Unlock()
+		metrics.SourceAccepted(s)
+		m.notifyPool()
+		return true, err
 	}
+	return false, err
 }
 
-// StartAutoCheck 启动自动存活检测
-func (m *SocksProxyManager) StartAutoCheck() {
+// StartAutoCheck 启动自动存活检测，ctx 取消后退出
+func (m *SocksProxyManager) StartAutoCheck(ctx context.Context) {
+	m.wg.Add(1)
 	go func() {
+		defer m.wg.Done()
 		for {
+			// 先在读锁内挑出需要检测的代理，避免持锁等待并发额度
 			m.mu.RLock()
-			var wg sizedwaitgroup.SizedWaitGroup
-			wg = sizedwaitgroup.New(m.config.CheckSock.MaxConcurrentReq)
-
+			var due []*ProxyInfo
 			for _, p := range m.proxyMap {
-				if !m.shouldCheckNow(p, time.Now()) {
-					continue
+				if m.shouldCheckNow(p, time.Now()) {
+					due = append(due, p)
 				}
+			}
+			m.mu.RUnlock()
 
-				wg.Add()
+			var wg sync.WaitGroup
+			for _, p := range due {
+				if err := m.limiter.Acquire(ctx); err != nil {
+					break
+				}
+				wg.Add(1)
 				go func(proxy *ProxyInfo) {
 					defer wg.Done()
-
-					isAlive, latency := m.checkProxyAlive(context.Background(), proxy)
-
-					m.mu.Lock()
-					proxy.IsAlive = isAlive
-					proxy.Latency = latency
-					proxy.LastChecked = time.Now()
-					m.mu.Unlock()
+					m.limiter.Release(isTimeout(m.recheck(ctx, proxy)))
 				}(p)
 			}
-
-			m.mu.RUnlock()
 			wg.Wait()
 
 			// 短暂休眠避免CPU空转
-			time.Sleep(1 * time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(1 * time.Second):
+			}
 		}
 	}()
 }
 
+// recheck 对代理池中的代理重新进行预检测与存活检测并更新状态，返回检测中遇到的错误
+func (m *SocksProxyManager) recheck(ctx context.Context, proxy *ProxyInfo) error {
+	if err := m.preCheck(ctx, proxy); err != nil {
+		m.mu.Lock()
+		changed := proxy.IsAlive
+		proxy.IsAlive = false
+		proxy.LastChecked = time.Now()
+		m.mu.Unlock()
+		if changed {
+			m.notifyPool()
+		}
+		return err
+	}
+
+	isAlive, latency, err := m.checkProxyAlive(ctx, proxy)
+	// 复检时延迟超过代理池允许的最大延迟同样视为不可用
+	isAlive = isAlive && m.acceptLatency(latency)
+
+	m.mu.Lock()
+	changed := proxy.IsAlive != isAlive
+	proxy.IsAlive = isAlive
+	proxy.Latency = latency
+	proxy.LastChecked = time.Now()
+	m.mu.Unlock()
+	if changed {
+		m.notifyPool()
+	}
+	return err
+}
+
+// acceptLatency 判断延迟是否在 checkSock.maxLatency 之内，maxLatency 不大于 0 时不限制
+func (m *SocksProxyManager) acceptLatency(latency time.Duration) bool {
+	maxLatency := time.Duration(m.conf().CheckSock.MaxLatency) * time.Millisecond
+	return maxLatency <= 0 || latency < maxLatency
+}
+
 // shouldCheckNow 判断是否需要立即检测
 func (m *SocksProxyManager) shouldCheckNow(p *ProxyInfo, now time.Time) bool {
 	if !p.IsAlive {
@@ -725,17 +880,26 @@ func (m *SocksProxyManager) shouldCheckNow(p *ProxyInfo, now time.Time) bool {
 	}
 
 	var interval time.Duration
+	// 与各代理源 Name() 的返回值一致
 	switch p.Source {
 	case "file":
-		interval = time.Duration(m.config.SourcesConfig.File.CheckInterval) * time.Second
+		interval = time.Duration(m.conf().SourcesConfig.File.CheckInterval) * time.Second
 	case "hunter":
-		interval = time.Duration(m.config.SourcesConfig.Hunter.CheckInterval) * time.Second
-	case "quake":
-		interval = time.Duration(m.config.SourcesConfig.Quake.CheckInterval) * time.Second
-	case "checkerProxy":
-		interval = time.Duration(m.config.SourcesConfig.CheckerProxy.CheckInterval) * time.Second
+		interval = time.Duration(m.conf().SourcesConfig.Hunter.CheckInterval) * time.Second
+	case "Quake":
+		interval = time.Duration(m.conf().SourcesConfig.Quake.CheckInterval) * time.Second
+	case "fofa":
+		interval = time.Duration(m.conf().SourcesConfig.Fofa.CheckInterval) * time.Second
+	case "shodan":
+		interval = time.Duration(m.conf().SourcesConfig.Shodan.CheckInterval) * time.Second
+	case "zoomeye":
+		interval = time.Duration(m.conf().SourcesConfig.ZoomEye.CheckInterval) * time.Second
+	case "censys":
+		interval = time.Duration(m.conf().SourcesConfig.Censys.CheckInterval) * time.Second
+	case "CheckerProxy":
+		interval = time.Duration(m.conf().SourcesConfig.CheckerProxy.CheckInterval) * time.Second
 	default:
-		interval = time.Duration(m.config.CheckSock.CheckInterval) * time.Second
+		interval = time.Duration(m.conf().CheckSock.CheckInterval) * time.Second
 	}
 
 	return now.Sub(p.LastChecked) > interval
@@ -752,81 +916,104 @@ func (m *SocksProxyManager) AliveProxy() int {
 	return count
 }
 
-func (m *SocksProxyManager) StartAutoSource() {
-	wg := sizedwaitgroup.New(m.config.CheckSock.MaxConcurrentReq)
-	wg2 := sizedwaitgroup.New(4)
-	go func() {
-		for {
-			if m.AliveProxy() >= m.config.CheckSock.MinSize {
-				continue
-			}
-
-			for _, s := range m.sources {
-				if !s.ValidateLastFetchTime() {
-					continue
-				}
-				if !s.IsAvailable() {
-					continue
-				}
-
-				wg2.Add()
-				go func(s source.Source) {
-					defer wg2.Done()
-					ctx, cancel := context.WithCancel(context.Background())
-					defer cancel()
-					proxyChan, err := s.Fetch(ctx)
-					if err != nil {
-						return
-					}
-					for p := range proxyChan {
-						m.mu.RLock()
-						if _, ok := m.proxyMap[p]; ok {
-							m.mu.RUnlock()
-							continue
-						}
-						m.mu.RUnlock()
-						gologger.Warning().Msgf("%s 获得 %s 正在检测代理可用性", s.Name(), p)
-
-						wg.Add()
-						go func(proxy string) {
-							defer wg.Done()
-							m.AddProxy(ctx, proxy, s.Name())
-						}(p)
-						if m.AliveProxy() >= m.config.CheckSock.MinSize {
-							gologger.Warning().Msgf("当前代理数量 %d 大于等于最小数量 %d", len(m.proxyMap), m.config.CheckSock.MinSize)
-							cancel()
-							return
-						}
-					}
-
-					wg.Wait()
+// fetchSource 从代理源获取代理并逐个检测入池，target 大于 0 时存活数量达到 target 后停止获取，返回本次获取的产出
+func (m *SocksProxyManager) fetchSource(ctx context.Context, s source.Source, target int) sourceYield {
+	// 只取消获取，已经开始的检测使用 ctx 继续完成
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var y sourceYield
+	proxyChan, err := s.Fetch(fetchCtx)
+	metrics.ObserveSourceFetch(s.Name(), err)
+	if err != nil {
+		return y
+	}
+	var (
+		wg       sync.WaitGroup
+		accepted atomic.Int64
+	)
+	for p := range proxyChan {
+		metrics.SourceFetched(s.Name())
+		m.mu.RLock()
+		if _, ok := m.proxyMap[p]; ok {
+			m.mu.RUnlock()
+			continue
+		}
+		m.mu.RUnlock()
+		m.logger.Warningf("%s 获得 %s 正在检测代理可用性", s.Name(), p)
 
-				}(s)
+		if err := m.limiter.Acquire(ctx); err != nil {
+			break
+		}
+		y.Fetched++
+		wg.Add(1)
+		go func(proxy string) {
+			defer wg.Done()
+			ok, err := m.addProxy(ctx, proxy, s.Name())
+			if ok {
+				accepted.Add(1)
 			}
-			wg2.Wait()
-
+			m.limiter.Release(isTimeout(err))
+		}(p)
+		if target > 0 && m.AliveProxy() >= target {
+			m.logger.Warningf("当前代理数量 %d 大于等于目标数量 %d", m.AliveProxy(), target)
+			cancel()
+			break
 		}
-	}()
+	}
+
+	wg.Wait()
+	y.Accepted = int(accepted.Load())
+	return y
 }
-func (m *SocksProxyManager) Start() func(network, addr string) (net.Conn, error) {
+
+// Run 启动自动保存、自动获取代理与自动存活检测，ctx 取消或调用 Close 后全部退出
+func (m *SocksProxyManager) Run(ctx context.Context) {
+	m.ctx, m.cancel = context.WithCancel(ctx)
+
 	// 开启 自动保存文件
-	m.StartAutoSave()
+	m.StartAutoSave(m.ctx)
 	// 开启 自动获取代理
-	m.StartAutoSource()
+	m.StartAutoSource(m.ctx)
 
 	// 开启 自动存活检测
-	m.StartAutoCheck()
+	m.StartAutoCheck(m.ctx)
+
+	// 开启 代理源变化监听
+	m.syncWatches()
+}
+
+// Close 停止所有后台循环，等待其退出后把存活代理最后保存一次
+func (m *SocksProxyManager) Close() error {
+	m.closeMu.Lock()
+	m.closed = true
+	m.closeMu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+	if filename := m.aliveDataPath(); filename != "" {
+		return m.SaveToFile(filename)
+	}
+	return nil
+}
+
+// enter 把一个随时可能开始的后台任务计入 wg，任务结束时调用 m.wg.Done()，Close 之后返回 false 且不计入
+func (m *SocksProxyManager) enter() bool {
+	m.closeMu.Lock()
+	defer m.closeMu.Unlock()
+	if m.closed {
+		return false
+	}
+	m.wg.Add(1)
+	return true
+}
+
+func (m *SocksProxyManager) Start() func(network, addr string) (net.Conn, error) {
+	m.Run(context.Background())
 	return m.Dial
 }
 
 func (m *SocksProxyManager) StartContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
-	// 开启 自动保存文件
-	m.StartAutoSave()
-	// 开启 自动获取代理
-	m.StartAutoSource()
-
-	// 开启 自动存活检测
-	m.StartAutoCheck()
+	m.Run(context.Background())
 	return m.DialContext
-
 }
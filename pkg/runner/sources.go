@@ -0,0 +1,180 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wjlin0/deadpool/pkg/source"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"time"
+)
+
+// Sources 返回当前启用的代理源
+func (m *SocksProxyManager) Sources() []source.Source {
+	m.srcMu.RLock()
+	defer m.srcMu.RUnlock()
+	sources := make([]source.Source, len(m.sources))
+	copy(sources, m.sources)
+	return sources
+}
+
+// buildSources 根据配置创建代理源，名称与配置都未变化的源沿用现有实例(保留上次获取时间等状态)
+// 同时返回每个源的配置指纹与调度配置
+func (m *SocksProxyManager) buildSources(cfg *types.ConfigOptions) ([]source.Source, map[string]string, map[string]types.Scheduling) {
+	m.srcMu.RLock()
+	current := make(map[string]source.Source, len(m.sources))
+	for _, s := range m.sources {
+		current[s.Name()] = s
+	}
+	oldFingerprints := m.fingerprints
+	m.srcMu.RUnlock()
+
+	var sources []source.Source
+	fingerprints := make(map[string]string)
+	schedules := make(map[string]types.Scheduling)
+	add := func(name string, conf interface{}, sched types.Scheduling, create func() source.Source) {
+		fp := fingerprint(conf)
+		fingerprints[name] = fp
+		schedules[name] = sched
+		if s, ok := current[name]; ok && oldFingerprints[name] == fp {
+			sources = append(sources, s)
+			return
+		}
+		s := create()
+		s.SetLogger(m.logger)
+		sources = append(sources, s)
+	}
+
+	sc := cfg.SourcesConfig
+	// 初始化 文件源
+	if sc.File.Enabled {
+		add("file", sc.File, sc.File.Scheduling, func() source.Source {
+			return source.NewFileSource(filePaths(sc.File), sc.File.LineFormat, sc.File.QueryTimeout)
+		})
+	}
+	if sc.Hunter.Enabled {
+		add("hunter", sc.Hunter, sc.Hunter.Scheduling, func() source.Source {
+			return m.withBudget(source.NewHunterSource(sc.Hunter.APIKey, sc.Hunter.Endpoint, sc.Hunter.Query, sc.Hunter.MaxSize, sc.Hunter.PageSize, sc.Hunter.Days, sc.Hunter.QueryTimeout), sc.Hunter.Budget)
+		})
+	}
+	if sc.CheckerProxy.Enabled {
+		add("CheckerProxy", sc.CheckerProxy, sc.CheckerProxy.Scheduling, func() source.Source {
+			return source.NewCheckerProxySource(sc.CheckerProxy.Endpoint, sc.CheckerProxy.QueryTimeout)
+		})
+	}
+	if sc.Quake.Enabled {
+		add("Quake", sc.Quake, sc.Quake.Scheduling, func() source.Source {
+			return m.withBudget(source.NewQuakeSource(sc.Quake.APIKey, sc.Quake.Endpoint, sc.Quake.Query, sc.Quake.MaxSize, sc.Quake.PageSize, sc.Quake.Days, sc.Quake.QueryTimeout), sc.Quake.Budget)
+		})
+	}
+	if sc.Fofa.Enabled {
+		add("fofa", sc.Fofa, sc.Fofa.Scheduling, func() source.Source {
+			return m.withBudget(source.NewFofaSource(sc.Fofa.Email, sc.Fofa.Key, sc.Fofa.Endpoint, sc.Fofa.Query, sc.Fofa.MaxSize, sc.Fofa.PageSize, sc.Fofa.Fields, sc.Fofa.Days, sc.Fofa.QueryTimeout), sc.Fofa.Budget)
+		})
+	}
+	if sc.Shodan.Enabled {
+		add("shodan", sc.Shodan, sc.Shodan.Scheduling, func() source.Source {
+			return m.withBudget(source.NewShodanSource(sc.Shodan.Key, sc.Shodan.Endpoint, sc.Shodan.Query, sc.Shodan.MaxSize, sc.Shodan.QueryTimeout), sc.Shodan.Budget)
+		})
+	}
+	if sc.ZoomEye.Enabled {
+		add("zoomeye", sc.ZoomEye, sc.ZoomEye.Scheduling, func() source.Source {
+			return m.withBudget(source.NewZoomEyeSource(sc.ZoomEye.APIKey, sc.ZoomEye.Endpoint, sc.ZoomEye.Query, sc.ZoomEye.PageSize, sc.ZoomEye.MaxSize, sc.ZoomEye.QueryTimeout), sc.ZoomEye.Budget)
+		})
+	}
+	if sc.Censys.Enabled {
+		add("censys", sc.Censys, sc.Censys.Scheduling, func() source.Source {
+			return m.withBudget(source.NewCensysSource(sc.Censys.APIID, sc.Censys.APISecret, sc.Censys.Endpoint, sc.Censys.Query, sc.Censys.PageSize, sc.Censys.MaxSize, sc.Censys.QueryTimeout), sc.Censys.Budget)
+		})
+	}
+	for i, custom := range sc.Customs {
+		name := fmt.Sprintf("custom-%d", i+1)
+		add(name, custom, custom.Scheduling, func() source.Source {
+			return source.NewCustomSource(name, custom.Endpoint, custom.Method, custom.Headers, custom.Body, custom.Extract, custom.LineFormat, custom.ResponseType, custom.QueryTimeout, custom.EnablePaging, custom.MaxSize)
+		})
+	}
+	return sources, fingerprints, schedules
+}
+
+// filePaths 合并文件源的 path 与 paths
+func filePaths(conf *types.FileSource) []string {
+	var paths []string
+	if conf.Path != "" {
+		paths = append(paths, conf.Path)
+	}
+	return append(paths, conf.Paths...)
+}
+
+// budgetedSource 按积分预算获取的搜索引擎数据源
+type budgetedSource interface {
+	source.Source
+	SetBudget(credits *source.Credits, pageDelay time.Duration)
+}
+
+// withBudget 为搜索引擎数据源设置积分预算与翻页间隔，积分用量按源名称记录
+func (m *SocksProxyManager) withBudget(s budgetedSource, budget types.Budget) source.Source {
+	s.SetBudget(m.credits.Credits(s.Name(), budget.DailyBudget, budget.MonthlyBudget), time.Duration(budget.PageDelay)*time.Second)
+	return s
+}
+
+// newCreditStore 加载搜索引擎数据源的积分用量与翻页进度，未配置文件或加载失败时只保存在内存中
+func newCreditStore(cfg *types.ConfigOptions, logger types.Logger) *source.CreditStore {
+	path := ""
+	if cfg.Options != nil {
+		path = cfg.Options.CreditDataPath
+	}
+	store, err := source.NewCreditStore(path)
+	if err != nil {
+		logger.Warningf("加载积分用量失败，本次运行不保存: %v", err)
+		store, _ = source.NewCreditStore("")
+	}
+	return store
+}
+
+// ApplyConfig 热加载已校验的配置：增删代理源、更新检测策略与并发，保留当前代理池与已建立的连接
+func (m *SocksProxyManager) ApplyConfig(cfg *types.ConfigOptions) {
+	old := m.conf()
+	if cfg.Options == nil {
+		cfg.Options = old.Options
+	}
+
+	sources, fingerprints, schedules := m.buildSources(cfg)
+
+	m.srcMu.Lock()
+	before := make(map[string]source.Source, len(m.sources))
+	for _, s := range m.sources {
+		before[s.Name()] = s
+	}
+	m.sources, m.fingerprints = sources, fingerprints
+	m.srcMu.Unlock()
+	m.sched.setSchedules(schedules)
+	m.config.Store(cfg)
+	// Run 之后才监听，未运行时由 Run 开始
+	if m.cancel != nil {
+		m.syncWatches()
+	}
+
+	m.resolvers.Store(newResolvers(cfg))
+	m.limiter.SetBounds(cfg.CheckSock.MinConcurrentReq, cfg.CheckSock.MaxConcurrentReq, cfg.CheckSock.Adaptive, cfg.CheckSock.TimeoutRatio)
+	// minSize 与代理源可能变化，重新计划获取
+	m.notifyPool()
+
+	for _, s := range sources {
+		prev, ok := before[s.Name()]
+		switch {
+		case !ok:
+			m.logger.Infof("新增代理源: %s", s.Name())
+		case prev != s:
+			m.logger.Infof("更新代理源: %s", s.Name())
+		}
+		delete(before, s.Name())
+	}
+	for name := range before {
+		m.logger.Infof("移除代理源: %s", name)
+	}
+}
+
+// fingerprint 返回配置的指纹，用于判断代理源配置是否变化
+func fingerprint(conf interface{}) string {
+	data, _ := json.Marshal(conf)
+	return string(data)
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"net/http"
+	"time"
+)
+
+// seconds 把以秒为单位的配置值转换为 time.Duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// dialTimeout 返回一次经代理拨号(TCP 连接 + SOCKS5 握手)允许的最长时间，total 更小时以 total 为准
+func dialTimeout(t *types.Timeouts) time.Duration {
+	d := seconds(t.Connect) + seconds(t.Handshake)
+	if t.Total > 0 && seconds(t.Total) < d {
+		d = seconds(t.Total)
+	}
+	return d
+}
+
+// newCheckClient 创建经由 proxyInfo 发起检测请求的 HTTP 客户端
+// 检测地址的域名按 res 解析，res 为 nil 时交给代理解析
+// 连接、握手、TLS、首字节分别使用 t 中的超时，整个请求不超过 total
+func newCheckClient(ctx context.Context, proxyInfo *ProxyInfo, res *dns.Resolver, t *types.Timeouts, total time.Duration) *retryablehttp.Client {
+	// 1. 创建SOCKS5拨号器
+	baseDialer := &net.Dialer{
+		Timeout:   seconds(t.Connect),
+		KeepAlive: total,
+	}
+
+	sd, _ := proxyInfo.NewDialer(baseDialer)
+
+	// 2. 创建HTTP客户端
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			ForceAttemptHTTP2: false, // 禁用 HTTP/2
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			TLSHandshakeTimeout:   seconds(t.TLS),
+			ResponseHeaderTimeout: seconds(t.FirstByte),
+			DialContext: func(_ctx context.Context, network, addr string) (net.Conn, error) {
+				dialCtx, cancel := context.WithTimeout(ctx, dialTimeout(t))
+				defer cancel()
+				if res != nil {
+					var err error
+					if addr, err = res.ResolveAddr(dialCtx, addr, sd.DialContext); err != nil {
+						return nil, err
+					}
+				}
+				return sd.DialContext(dialCtx, network, addr)
+			},
+		},
+		Timeout: total,
+	}
+	defaultOptions := retryablehttp.DefaultOptionsSingle
+	defaultOptions.HttpClient = httpClient
+	defaultOptions.Timeout = total
+	defaultOptions.RetryWaitMax = total
+	defaultOptions.RetryMax = 0
+	return retryablehttp.NewClient(defaultOptions)
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"context"
+	"github.com/wjlin0/deadpool/pkg/source"
+)
+
+// watchedSource 内容变化时可以立即通知的代理源，如文件源
+type watchedSource interface {
+	source.Source
+	Watch(ctx context.Context, onChange func()) error
+	// Snapshot 返回源当前的完整代理列表，用于删除已从源中移除的代理
+	Snapshot() ([]string, error)
+}
+
+// syncWatches 为开启监听的代理源开始监听，停止已被移除或替换的代理源的监听
+func (m *SocksProxyManager) syncWatches() {
+	fileConf := m.conf().SourcesConfig.File
+
+	m.srcMu.Lock()
+	defer m.srcMu.Unlock()
+	if m.watches == nil {
+		m.watches = make(map[source.Source]context.CancelFunc)
+	}
+	current := make(map[source.Source]bool, len(m.sources))
+	for _, s := range m.sources {
+		current[s] = true
+	}
+	for s, cancel := range m.watches {
+		if !current[s] {
+			cancel()
+			delete(m.watches, s)
+		}
+	}
+
+	for _, s := range m.sources {
+		ws, ok := s.(watchedSource)
+		if !ok || !fileConf.Watch {
+			continue
+		}
+		if _, ok := m.watches[s]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		prune := fileConf.Prune
+		onChange := func() {
+			if !m.enter() {
+				return
+			}
+			defer m.wg.Done()
+			m.syncSource(ctx, ws, prune)
+		}
+		if err := ws.Watch(ctx, onChange); err != nil {
+			cancel()
+			m.logger.Warningf("监听代理源 %s 失败: %v", s.Name(), err)
+			continue
+		}
+		m.watches[s] = cancel
+		m.logger.Infof("开始监听代理源 %s 的变化", s.Name())
+		// 删除停止运行期间已从源中移除的代理
+		if prune && m.enter() {
+			go func() {
+				defer m.wg.Done()
+				m.pruneSource(ws)
+			}()
+		}
+	}
+}
+
+// syncSource 代理源变化后立即获取并检测新增的代理，不受获取间隔与代理池数量的限制，prune 为 true 时先删除已移除的代理
+func (m *SocksProxyManager) syncSource(ctx context.Context, s watchedSource, prune bool) {
+	if prune {
+		m.pruneSource(s)
+	}
+	m.logger.Infof("代理源 %s 发生变化，重新获取", s.Name())
+	m.sched.recordYield(s.Name(), m.fetchSource(ctx, s, 0))
+}
+
+// pruneSource 删除代理池中来自该源、但已不在源中的代理，读取失败时不删除
+func (m *SocksProxyManager) pruneSource(s watchedSource) {
+	proxies, err := s.Snapshot()
+	if err != nil {
+		m.logger.Warningf("读取代理源 %s 失败，跳过删除: %v", s.Name(), err)
+		return
+	}
+	keep := make(map[string]bool, len(proxies))
+	for _, p := range proxies {
+		keep[p] = true
+	}
+
+	m.mu.Lock()
+	var removed int
+	for u, p := range m.proxyMap {
+		if p.Source == s.Name() && !keep[u] {
+			delete(m.proxyMap, u)
+			if m.lastProxyURL == u {
+				m.lastProxyURL = ""
+			}
+			removed++
+		}
+	}
+	m.mu.Unlock()
+	if removed > 0 {
+		m.logger.Infof("已删除 %d 个从代理源 %s 中移除的代理", removed, s.Name())
+		m.notifyPool()
+	}
+}
@@ -0,0 +1,411 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/armon/go-socks5"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/deadpool/pkg/accesslog"
+	"github.com/wjlin0/deadpool/pkg/acl"
+	"github.com/wjlin0/deadpool/pkg/auth"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/metrics"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DialFunc 建立上游连接的函数，通常为 SocksProxyManager.DialContext
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Server SOCKS5 监听服务，支持停止接受新连接并等待已有隧道结束
+type Server struct {
+	name      string // 监听地址，作为指标与访问日志的 listener 标签
+	dial      DialFunc
+	handler   atomic.Pointer[handler]
+	accessLog atomic.Pointer[accesslog.Logger]
+	quota     atomic.Pointer[quota.Manager]
+	users     atomic.Pointer[auth.Store]
+
+	mu       sync.Mutex
+	config   *types.Listener
+	listener net.Listener
+	conns    map[*trackedConn]struct{} // 活跃的客户端连接
+	byAddr   map[string]*trackedConn   // 客户端地址 -> 活跃的客户端连接，用于在握手后找到连接对应的会话
+	closing  bool
+	drained  chan struct{} // 关闭中且活跃连接归零时关闭
+}
+
+// New 根据监听配置创建 SOCKS5 服务
+func New(cfg *types.Listener, dial DialFunc) (*Server, error) {
+	s := &Server{
+		name:   net.JoinHostPort(cfg.IP, fmt.Sprint(cfg.Port)),
+		dial:   dial,
+		config: cfg,
+		conns:  make(map[*trackedConn]struct{}),
+		byAddr: make(map[string]*trackedConn),
+	}
+	h, err := s.newHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.handler.Store(h)
+	return s, nil
+}
+
+// Reload 热加载监听配置，新的认证信息与客户端访问控制只对之后建立的连接生效，已建立的连接不受影响
+// 监听地址的变化需要重启才能生效
+func (s *Server) Reload(cfg *types.Listener) error {
+	commit, err := s.PrepareReload(cfg)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// PrepareReload 根据监听配置创建新的连接处理方式，返回的 commit 调用后新配置才生效，出错时当前配置不受影响
+func (s *Server) PrepareReload(cfg *types.Listener) (commit func(), err error) {
+	h, err := s.newHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		s.mu.Lock()
+		old := s.config
+		if old.IP != cfg.IP || old.Port != cfg.Port {
+			gologger.Warning().Msgf("监听地址变更为 %s:%d，需要重启后生效，当前仍监听 %s:%d", cfg.IP, cfg.Port, old.IP, old.Port)
+			cfg.IP, cfg.Port = old.IP, old.Port
+		}
+		s.config = cfg
+		s.mu.Unlock()
+
+		s.handler.Store(h)
+	}, nil
+}
+
+// SetAccessLog 设置访问日志，每个客户端连接关闭时写入一条，nil 表示不记录
+func (s *Server) SetAccessLog(l *accesslog.Logger) {
+	s.accessLog.Store(l)
+}
+
+// SetQuota 设置用户配额，认证用户的每个请求在拨号前检查配额，nil 表示不限制
+func (s *Server) SetQuota(q *quota.Manager) {
+	s.quota.Store(q)
+}
+
+// SetUsers 设置用户文件中的认证信息，与监听配置中的 auths 同时生效，nil 表示只使用 auths
+func (s *Server) SetUsers(users *auth.Store) error {
+	s.users.Store(users)
+	s.mu.Lock()
+	cfg := s.config
+	s.mu.Unlock()
+	return s.Reload(cfg)
+}
+
+// handler 一份监听配置对应的连接处理方式，热加载时整体替换
+type handler struct {
+	socks    *socks5.Server // 按配置认证的 SOCKS5 服务器
+	exempt   *socks5.Server // authExempt 中的客户端使用的无需认证的服务器，未配置时为 nil
+	acl      *acl.Client
+	dest     *acl.Destination
+	resolver *dns.Resolver // 目标域名的解析方式，nil 表示使用系统的解析器在本地解析
+}
+
+// newHandler 根据监听配置创建客户端访问控制与底层的 SOCKS5 服务器
+func (s *Server) newHandler(cfg *types.Listener) (*handler, error) {
+	clientACL, err := acl.NewClient(cfg.Allow, cfg.Deny, cfg.AuthExempt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener ACL: %v", err)
+	}
+	dest, err := acl.NewDestination(cfg.Destinations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener destinations: %v", err)
+	}
+	resolver, err := dns.New(cfg.DNS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener dns: %v", err)
+	}
+	h := &handler{acl: clientACL, dest: dest, resolver: resolver}
+	socksServer, authEnabled, err := s.newSocksServer(cfg, h)
+	if err != nil {
+		return nil, err
+	}
+	h.socks = socksServer
+
+	if authEnabled && clientACL.HasAuthExempt() {
+		// 认证方式在握手时协商，无法按客户端区分，因此为无需认证的客户端单独创建一个服务器
+		if h.exempt, err = socks5.New(s.socksConfig(h)); err != nil {
+			return nil, fmt.Errorf("failed to create SOCKS5 server: %v", err)
+		}
+	}
+	if !authEnabled && !clientACL.HasAllow() {
+		if ip := net.ParseIP(cfg.IP); ip == nil || !ip.IsLoopback() {
+			gologger.Warning().Msgf("%s 未启用认证也未配置 allow，任何能访问该地址的人都可以使用代理", net.JoinHostPort(cfg.IP, fmt.Sprint(cfg.Port)))
+		}
+	}
+	return h, nil
+}
+
+// socksConfig 返回不含认证的 SOCKS5 服务器配置
+func (s *Server) socksConfig(h *handler) *socks5.Config {
+	return &socks5.Config{
+		Dial:     s.dialUpstream,
+		Rules:    sessionRules{server: s, dest: h.dest},
+		Resolver: listenerResolver{resolver: h.resolver},
+	}
+}
+
+// newSocksServer 根据监听配置创建底层的 SOCKS5 服务器，并返回是否启用了认证
+func (s *Server) newSocksServer(cfg *types.Listener, h *handler) (*socks5.Server, bool, error) {
+	// 创建SOCKS5服务器配置
+	conf := s.socksConfig(h)
+	// 配置认证（如果设置了认证信息）
+	users := s.users.Load()
+	if len(cfg.Auths) > 0 || users != nil {
+		creds := socks5.StaticCredentials{}
+		for _, entry := range cfg.Auths {
+			// 只按第一个冒号分隔，密码中可以包含冒号
+			username, password, _ := strings.Cut(entry, ":")
+			username, password = strings.TrimSpace(username), strings.TrimSpace(password)
+			if username != "" && password != "" {
+				creds[username] = password
+			}
+		}
+
+		// 只有有效的认证信息才设置
+		if len(creds) > 0 || users != nil {
+			conf.AuthMethods = []socks5.Authenticator{socks5.UserPassAuthenticator{
+				Credentials: countingCredentials{static: creds, users: users, listener: s.name},
+			}}
+			if users != nil {
+				gologger.Info().Msgf("Enabled SOCKS5 authentication with %d credentials and users file %s", len(creds), users.Path())
+			} else {
+				gologger.Info().Msgf("Enabled SOCKS5 authentication with %d credentials", len(creds))
+			}
+		} else {
+			gologger.Warning().Msg("No valid credentials found, running without authentication")
+		}
+	} else {
+		gologger.Info().Msg("Running SOCKS5 server without authentication")
+	}
+
+	// 创建SOCKS5服务器
+	socksServer, err := socks5.New(conf)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create SOCKS5 server: %v", err)
+	}
+	return socksServer, len(conf.AuthMethods) > 0, nil
+}
+
+// dialUpstream 建立上游连接，记录拨号指标，并把上游信息、连接耗时与经过的字节数记入会话
+func (s *Server) dialUpstream(ctx context.Context, network, addr string) (net.Conn, error) {
+	sess := sessionFromContext(ctx)
+	if sess != nil {
+		ctx = types.WithDialInfo(ctx, &sess.dialInfo)
+	}
+	start := time.Now()
+	conn, err := s.dial(ctx, network, addr)
+	metrics.ObserveDial(s.name, start, err)
+	if err != nil {
+		return nil, err
+	}
+	conn = metrics.TrackTunnel(s.name, conn)
+	if sess != nil {
+		sess.connect = time.Since(start)
+		conn = &sessionConn{Conn: conn, session: sess}
+	}
+	return conn, nil
+}
+
+// countingCredentials 依次校验 auths 与用户文件，并统计认证失败次数
+type countingCredentials struct {
+	static   socks5.StaticCredentials
+	users    *auth.Store
+	listener string
+}
+
+func (c countingCredentials) Valid(user, password string) bool {
+	if c.static.Valid(user, password) {
+		return true
+	}
+	if c.users != nil && c.users.Valid(user, password) {
+		return true
+	}
+	metrics.AuthFailed(c.listener)
+	return false
+}
+
+// Addr 返回配置的监听地址
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return net.JoinHostPort(s.config.IP, fmt.Sprint(s.config.Port))
+}
+
+// ListenAndServe 开始监听并处理连接，调用 Shutdown 后返回 nil
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr())
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在指定的 listener 上处理连接，调用 Shutdown 后返回 nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		_ = l.Close()
+		return nil
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			if closing {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		// 在握手之前按客户端地址检查访问控制
+		h := s.handler.Load()
+		client := acl.AddrOf(conn.RemoteAddr())
+		if err := h.acl.Check(client); err != nil {
+			s.rejectClient(conn, err)
+			continue
+		}
+		socksServer := h.socks
+		if h.exempt != nil && h.acl.AuthExempt(client) {
+			socksServer = h.exempt
+		}
+
+		tc, ok := s.track(conn)
+		if !ok {
+			_ = conn.Close()
+			continue
+		}
+		go func() {
+			err := socksServer.ServeConn(tc)
+			if err != nil {
+				gologger.Debug().Msgf("socks: %v", err)
+			}
+			tc.session.lease.Release()
+			s.logAccess(tc.session, err)
+		}()
+	}
+}
+
+// rejectClient 关闭被访问控制拒绝的客户端连接，记录日志、指标与访问日志
+func (s *Server) rejectClient(conn net.Conn, err error) {
+	_ = conn.Close()
+	reason := "deny"
+	if errors.Is(err, acl.ErrClientNotAllowed) {
+		reason = "not_allowed"
+	}
+	metrics.ClientRejected(s.name, reason)
+	gologger.Info().Msgf("拒绝客户端 %s 的连接: %v", conn.RemoteAddr(), err)
+
+	sess := newSession(conn)
+	sess.reject = "acl: " + err.Error()
+	s.logAccess(sess, nil)
+}
+
+// ActiveConns 返回当前活跃的客户端连接数
+func (s *Server) ActiveConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Shutdown 停止接受新连接并等待活跃隧道结束；ctx 到期后强制关闭剩余连接并返回 ctx 的错误
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closing {
+		s.closing = true
+		s.drained = make(chan struct{})
+		if s.listener != nil {
+			_ = s.listener.Close()
+		}
+		if len(s.conns) == 0 {
+			close(s.drained)
+		}
+	}
+	drained := s.drained
+	s.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		remaining := make([]*trackedConn, 0, len(s.conns))
+		for c := range s.conns {
+			remaining = append(remaining, c)
+		}
+		s.mu.Unlock()
+		for _, c := range remaining {
+			_ = c.Close()
+		}
+		gologger.Warning().Msgf("强制关闭 %d 个未结束的连接", len(remaining))
+		return ctx.Err()
+	}
+}
+
+func (s *Server) track(conn net.Conn) (*trackedConn, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return nil, false
+	}
+	tc := &trackedConn{Conn: conn, server: s, session: newSession(conn)}
+	s.conns[tc] = struct{}{}
+	s.byAddr[tc.session.client] = tc
+	return tc, true
+}
+
+func (s *Server) untrack(tc *trackedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[tc]; !ok {
+		return
+	}
+	delete(s.conns, tc)
+	if s.byAddr[tc.session.client] == tc {
+		delete(s.byAddr, tc.session.client)
+	}
+	if s.closing && len(s.conns) == 0 {
+		close(s.drained)
+	}
+}
+
+// trackedConn 关闭时从活跃连接中移除的客户端连接
+type trackedConn struct {
+	net.Conn
+	server  *Server
+	session *session
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.server.untrack(c) })
+	return err
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"github.com/armon/go-socks5"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/deadpool/pkg/accesslog"
+	"github.com/wjlin0/deadpool/pkg/acl"
+	"github.com/wjlin0/deadpool/pkg/dns"
+	"github.com/wjlin0/deadpool/pkg/quota"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// session 一个客户端连接的访问信息，连接关闭时写入访问日志
+type session struct {
+	start  time.Time
+	client string
+
+	// 以下字段在处理连接的 goroutine 中依次写入，连接关闭后读取
+	user        string
+	destination string
+	dialInfo    types.DialInfo
+	connect     time.Duration
+	lease       *quota.Lease // 认证用户占用的配额，连接结束时释放
+	reject      string       // 请求被拒绝的原因，写入访问日志
+
+	up   atomic.Int64 // 客户端 -> 目标的字节数
+	down atomic.Int64 // 目标 -> 客户端的字节数
+}
+
+func newSession(conn net.Conn) *session {
+	return &session{start: time.Now(), client: conn.RemoteAddr().String()}
+}
+
+type sessionKey struct{}
+
+func sessionFromContext(ctx context.Context) *session {
+	sess, _ := ctx.Value(sessionKey{}).(*session)
+	return sess
+}
+
+type resolvedKey struct{}
+
+// listenerResolver 监听的域名解析：local 模式在本地解析，解析失败时客户端收到 0x04 (host unreachable)
+// 解析结果只用于目标地址规则与路由，拨号地址保留域名，由拨号方按代理池的配置决定如何解析；其余模式不在本地解析
+type listenerResolver struct {
+	resolver *dns.Resolver
+}
+
+func (r listenerResolver) Resolve(ctx context.Context, name string) (context.Context, net.IP, error) {
+	if r.resolver.Mode() != dns.ModeLocal {
+		return ctx, nil, nil
+	}
+	ips, err := r.resolver.LookupIP(ctx, name, nil)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, resolvedKey{}, ips[0]), nil, nil
+}
+
+// sessionRules 在 SOCKS5 握手完成、拨号之前记录认证用户与目标地址，检查目标地址规则与用户配额，并把会话放入拨号使用的 ctx
+// 拒绝时客户端收到 0x02 (connection not allowed by ruleset)
+type sessionRules struct {
+	server *Server
+	dest   *acl.Destination
+}
+
+func (r sessionRules) Allow(ctx context.Context, req *socks5.Request) (context.Context, bool) {
+	user := ""
+	if req.AuthContext != nil {
+		user = req.AuthContext.Payload["Username"]
+	}
+	sess := r.session(req)
+	if sess != nil {
+		sess.user = user
+		sess.destination = destination(req.DestAddr)
+	}
+	// 拨号时按用户与客户端请求的域名路由，本地解析得到的 IP 一并交给拨号方
+	var resolved net.IP
+	if req.DestAddr != nil {
+		resolved = req.DestAddr.IP
+		if ip, ok := ctx.Value(resolvedKey{}).(net.IP); ok {
+			resolved = ip
+		}
+		info := &types.Request{User: user, FQDN: req.DestAddr.FQDN, IP: resolved}
+		if r.dest != nil {
+			fqdn, port := req.DestAddr.FQDN, req.DestAddr.Port
+			info.CheckDirect = func(ip net.IP) error {
+				addr, _ := netip.AddrFromSlice(ip)
+				return r.dest.Check(user, fqdn, addr, port)
+			}
+		}
+		ctx = types.WithRequest(ctx, info)
+	}
+
+	// 在选择上游之前检查目标地址，域名在本地解析时同时按域名与解析得到的 IP 匹配
+	if r.dest != nil && req.DestAddr != nil {
+		ip, _ := netip.AddrFromSlice(resolved)
+		if err := r.dest.Check(user, req.DestAddr.FQDN, ip, req.DestAddr.Port); err != nil {
+			gologger.Debug().Msgf("拒绝访问 %s: %v", destination(req.DestAddr), err)
+			if sess != nil {
+				sess.reject = "acl: " + err.Error()
+			}
+			return ctx, false
+		}
+	}
+	if sess == nil {
+		return ctx, true
+	}
+
+	if q := r.server.quota.Load(); q != nil && sess.user != "" {
+		lease, err := q.Acquire(sess.user, req.DestAddr.Port)
+		if err != nil {
+			sess.reject = "quota: " + err.Error()
+			gologger.Debug().Msgf("拒绝用户 %s 访问 %s: %v", sess.user, sess.destination, err)
+			return ctx, false
+		}
+		sess.lease = lease
+	}
+	return context.WithValue(ctx, sessionKey{}, sess), true
+}
+
+// session 返回请求所属客户端连接的会话，找不到时返回 nil
+func (r sessionRules) session(req *socks5.Request) *session {
+	if req.RemoteAddr == nil {
+		return nil
+	}
+	client := (&net.TCPAddr{IP: req.RemoteAddr.IP, Port: req.RemoteAddr.Port}).String()
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	if tc := r.server.byAddr[client]; tc != nil {
+		return tc.session
+	}
+	return nil
+}
+
+// destination 返回客户端请求的目标 host:port，客户端使用域名时保留域名
+func destination(a *socks5.AddrSpec) string {
+	if a == nil {
+		return ""
+	}
+	host := a.FQDN
+	if host == "" {
+		host = a.IP.String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(a.Port))
+}
+
+// logAccess 连接关闭时写入访问日志
+func (s *Server) logAccess(sess *session, err error) {
+	l := s.accessLog.Load()
+	if l == nil {
+		return
+	}
+	reason := "closed"
+	switch {
+	case sess.reject != "":
+		reason = sess.reject
+	case err != nil:
+		reason = err.Error()
+	}
+	entry := &accesslog.Entry{
+		Time:        sess.start,
+		Listener:    s.name,
+		Client:      sess.client,
+		User:        sess.user,
+		Destination: sess.destination,
+		Upstream:    sess.dialInfo.Upstream,
+		ExitIP:      sess.dialInfo.ExitIP,
+		ConnectMs:   sess.connect.Milliseconds(),
+		BytesUp:     sess.up.Load(),
+		BytesDown:   sess.down.Load(),
+		DurationMs:  time.Since(sess.start).Milliseconds(),
+		Reason:      reason,
+	}
+	if err := l.Log(entry); err != nil {
+		gologger.Warning().Msgf("写入访问日志失败: %v", err)
+	}
+}
+
+// sessionConn 把经过的字节数记入会话与用户配额的上游连接，写入为上行，读取为下行
+// 超出流量配额时返回错误，结束隧道
+type sessionConn struct {
+	net.Conn
+	session *session
+}
+
+func (c *sessionConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.session.down.Add(int64(n))
+	if qerr := c.session.lease.Add(n); qerr != nil && err == nil {
+		err = qerr
+	}
+	return n, err
+}
+
+func (c *sessionConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.session.up.Add(int64(n))
+	if qerr := c.session.lease.Add(n); qerr != nil && err == nil {
+		err = qerr
+	}
+	return n, err
+}
+
+// CloseWrite 转发半关闭，客户端发送完毕后通知上游
+func (c *sessionConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CensysSource struct {
+	*BaseSource
+	apiID     string
+	apiSecret string
+	endpoint  string
+	query     string
+	pageSize  int
+	maxSize   int
+}
+
+func NewCensysSource(apiID, apiSecret, endpoint, query string, pageSize, maxSize int, timeout int) *CensysSource {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	return &CensysSource{
+		BaseSource: NewBaseSource("censys", timeout),
+		apiID:      apiID,
+		apiSecret:  apiSecret,
+		endpoint:   endpoint,
+		query:      query,
+		pageSize:   pageSize,
+		maxSize:    maxSize,
+	}
+}
+
+// censysResponse Censys /api/v2/hosts/search 的响应，一个主机可能有多个服务
+type censysResponse struct {
+	Code   int    `json:"code"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Result struct {
+		Hits []struct {
+			IP       string `json:"ip"`
+			Services []struct {
+				Port        int    `json:"port"`
+				ServiceName string `json:"service_name"`
+			} `json:"services"`
+		} `json:"hits"`
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"result"`
+}
+
+func (c *CensysSource) Fetch(ctx context.Context) (<-chan string, error) {
+	proxyChan := make(chan string)
+
+	c.markFetched()
+
+	go func() {
+		defer close(proxyChan)
+
+		client := newEngineClient()
+		credits, delay := c.budget(time.Second)
+		window := c.query
+		_, cursor := credits.Resume(window)
+		totalFetched := 0
+		for {
+			// Censys 每次查询扣除 1 个积分
+			if !c.allowPage(credits, 1) {
+				return
+			}
+
+			params := url.Values{}
+			params.Set("q", c.query)
+			params.Set("per_page", strconv.Itoa(c.pageSize))
+			if cursor != "" {
+				params.Set("cursor", cursor)
+			}
+
+			c.Logger().Infof("fetching %d hosts from %s", c.pageSize, c.endpoint)
+			req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+"?"+params.Encode(), nil)
+			if err != nil {
+				return
+			}
+			req.SetBasicAuth(c.apiID, c.apiSecret)
+			resp, err := client.Do(req)
+			if err != nil {
+				c.fail(fmt.Errorf("query censys error: %v", err))
+				return
+			}
+			var result censysResponse
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized:
+				c.disable(fmt.Sprintf("authentication failed: %s %s", resp.Status, result.Error))
+				return
+			case resp.StatusCode == http.StatusForbidden, strings.Contains(strings.ToLower(result.Error), "quota"):
+				c.disable(fmt.Sprintf("quota exhausted: %s %s", resp.Status, result.Error))
+				return
+			case err != nil:
+				c.fail(fmt.Errorf("query censys error: %s: %v", resp.Status, err))
+				return
+			case resp.StatusCode != http.StatusOK:
+				c.fail(fmt.Errorf("query censys error: %s %s", resp.Status, result.Error))
+				if cursor != "" {
+					// 保存的游标可能已失效，下次从第一页开始
+					c.advance(credits, window, 1, "")
+				}
+				return
+			}
+			c.ReportSuccess()
+			c.spend(credits, 1, -1)
+
+			for _, hit := range result.Result.Hits {
+				for _, service := range hit.Services {
+					// 本页还有未取的结果时不推进游标，下次从本页继续
+					if c.maxSize > 0 && totalFetched >= c.maxSize {
+						return
+					}
+					scheme := schemeFor(service.ServiceName)
+					if scheme == "" || hit.IP == "" {
+						continue
+					}
+					select {
+					case <-ctx.Done():
+						return
+					case proxyChan <- fmt.Sprintf("%s://%s:%d", scheme, hit.IP, service.Port):
+						totalFetched++
+					}
+				}
+			}
+
+			// 本页已全部取完才推进游标，Censys 使用游标翻页，没有下一页时 next 为空
+			cursor = result.Result.Links.Next
+			last := cursor == "" || len(result.Result.Hits) == 0
+			if last {
+				c.advance(credits, window, 1, "")
+			} else {
+				c.advance(credits, window, 1, cursor)
+			}
+			if last || (c.maxSize > 0 && totalFetched >= c.maxSize) {
+				return
+			}
+			if !waitPage(ctx, delay) {
+				return
+			}
+		}
+	}()
+
+	return proxyChan, nil
+}
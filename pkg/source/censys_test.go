@@ -0,0 +1,92 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCensysFetch(t *testing.T) {
+	pages := map[string][]byte{
+		"":                     readFixture(t, "censys_search_page1.json"),
+		"eyJhZnRlciI6WzEwMF19": readFixture(t, "censys_search_page2.json"),
+	}
+	var (
+		mu      sync.Mutex
+		cursors []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+			t.Errorf("unexpected basic auth: %q %q", id, secret)
+		}
+		q := r.URL.Query()
+		if q.Get("q") != "services.service_name: SOCKS" || q.Get("per_page") != "50" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		cursor := q.Get("cursor")
+		mu.Lock()
+		cursors = append(cursors, cursor)
+		mu.Unlock()
+		_, _ = w.Write(pages[cursor])
+	}))
+	defer srv.Close()
+
+	c := NewCensysSource("id", "secret", srv.URL, "services.service_name: SOCKS", 50, 0, 10)
+	c.SetBudget(nil, time.Millisecond)
+	ch, err := c.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 一个主机的多个 SOCKS 服务分别作为代理，其他服务被忽略
+	want := []string{"socks5://192.0.2.30:1080", "socks5://192.0.2.31:1081", "socks5://192.0.2.31:1082"}
+	if got := collect(t, ch); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxies = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(cursors, []string{"", "eyJhZnRlciI6WzEwMF19"}) {
+		t.Errorf("cursors = %q", cursors)
+	}
+}
+
+func TestCensysErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		health Health
+		reason string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"code": 401, "status": "Unauthorized", "error": "You must authenticate with a valid API ID and secret."}`, HealthFailing, "authentication failed"},
+		{"quota", http.StatusForbidden, `{"code": 403, "status": "Forbidden", "error": "You have used your full quota for this billing period."}`, HealthFailing, "quota exhausted"},
+		{"server error", http.StatusInternalServerError, `{"code": 500, "status": "Internal Server Error", "error": "Unexpected error"}`, HealthDegraded, "query censys error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := NewCensysSource("id", "secret", srv.URL, "services.service_name: SOCKS", 50, 0, 10)
+			ch, err := c.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collect(t, ch); len(got) != 0 {
+				t.Errorf("proxies = %v, want none", got)
+			}
+			st := c.Status()
+			if st.Health != tt.health {
+				t.Errorf("health = %s, want %s", st.Health, tt.health)
+			}
+			if !strings.HasPrefix(st.LastError, tt.reason) {
+				t.Errorf("last error = %q, want prefix %q", st.LastError, tt.reason)
+			}
+		})
+	}
+}
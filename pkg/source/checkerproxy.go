@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/projectdiscovery/gologger"
 	"net/http"
 	"time"
 )
@@ -23,7 +22,7 @@ func NewCheckerProxySource(endpoint string, timeout int) *CheckerProxySource {
 
 func (h *CheckerProxySource) Fetch(ctx context.Context) (<-chan string, error) {
 	proxyChan := make(chan string)
-	h.lastFetchTime = time.Now()
+	h.markFetched()
 
 	go func() {
 		defer close(proxyChan)
@@ -36,9 +35,12 @@ func (h *CheckerProxySource) Fetch(ctx context.Context) (<-chan string, error) {
 			},
 		}
 
+		normalizer, _ := NewNormalizer(nil, "")
 		totalFetched := 0
 		maxDays := 5 // 最多回溯5天
 		daysChecked := 0
+		var lastErr error // 最近一天的错误，所有日期都失败时记为一次失败
+		succeeded := false
 
 		for daysChecked < maxDays {
 			select {
@@ -49,18 +51,20 @@ func (h *CheckerProxySource) Fetch(ctx context.Context) (<-chan string, error) {
 				checkDate := time.Now().AddDate(0, 0, -daysChecked).Format("2006-01-02")
 				reqUrl := fmt.Sprintf("%s/%s", h.endpoint, checkDate)
 
-				gologger.Info().Msgf("Fetching proxies for date: %s", reqUrl)
+				h.Logger().Infof("Fetching proxies for date: %s", reqUrl)
 
 				req, err := http.NewRequestWithContext(ctx, "GET", reqUrl, nil)
 				if err != nil {
-					gologger.Error().Msgf("Failed to create request: %v", err)
+					h.Logger().Errorf("Failed to create request: %v", err)
+					lastErr = err
 					daysChecked++
 					continue
 				}
 
 				resp, err := client.Do(req)
 				if err != nil {
-					gologger.Error().Msgf("Request failed for date %s: %v", checkDate, err)
+					h.Logger().Errorf("Request failed for date %s: %v", checkDate, err)
+					lastErr = err
 					daysChecked++
 					continue
 				}
@@ -74,7 +78,8 @@ func (h *CheckerProxySource) Fetch(ctx context.Context) (<-chan string, error) {
 				}
 
 				if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-					gologger.Error().Msgf("Failed to decode response for date %s: %v", checkDate, err)
+					h.Logger().Errorf("Failed to decode response for date %s: %v", checkDate, err)
+					lastErr = fmt.Errorf("decode response for date %s: %v", checkDate, err)
 					resp.Body.Close()
 					daysChecked++
 					continue
@@ -82,17 +87,23 @@ func (h *CheckerProxySource) Fetch(ctx context.Context) (<-chan string, error) {
 				resp.Body.Close()
 
 				if !result.Success {
-					gologger.Error().Msgf("Unsuccessful response for date %s: %s", checkDate, result.Message)
+					h.Logger().Errorf("Unsuccessful response for date %s: %s", checkDate, result.Message)
+					lastErr = fmt.Errorf("unsuccessful response for date %s: %s", checkDate, result.Message)
 					daysChecked++
 					continue
 				}
 
+				succeeded = true
 				// 发送获取到的代理
 				for _, item := range result.Data.ProxyList {
+					proxy, ok := normalizer.Normalize(item)
+					if !ok {
+						continue
+					}
 					select {
 					case <-ctx.Done():
 						return
-					case proxyChan <- fmt.Sprintf("socks5://%s", item):
+					case proxyChan <- proxy:
 						totalFetched++
 					}
 				}
@@ -102,7 +113,13 @@ func (h *CheckerProxySource) Fetch(ctx context.Context) (<-chan string, error) {
 			}
 		}
 
-		gologger.Info().Msgf("Finished checking %d days, total proxies fetched: %d", daysChecked, totalFetched)
+		h.Logger().Infof("Finished checking %d days, total proxies fetched: %d", daysChecked, totalFetched)
+		h.reportRejected(normalizer.Rejected())
+		if succeeded || lastErr == nil {
+			h.ReportSuccess()
+		} else {
+			h.ReportFailure(lastErr)
+		}
 	}()
 
 	return proxyChan, nil
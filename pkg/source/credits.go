@@ -0,0 +1,211 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	creditDayLayout   = "2006-01-02"
+	creditMonthLayout = "2006-01"
+)
+
+// ErrBudgetExhausted 当天或当月的积分预算已用完
+var ErrBudgetExhausted = errors.New("credit budget exhausted")
+
+// CreditState 一个搜索引擎数据源的积分用量与翻页进度
+type CreditState struct {
+	Day       string    `json:"day"`
+	UsedDay   int       `json:"used_day"` // 当天已消耗的积分
+	Month     string    `json:"month"`
+	UsedMonth int       `json:"used_month"`       // 当月已消耗的积分
+	Remaining int       `json:"remaining"`        // 接口返回的剩余积分，-1 表示接口未提供
+	Window    string    `json:"window,omitempty"` // 翻页进度对应的查询语句与时间窗口
+	Page      int       `json:"page,omitempty"`   // 下次获取的页码
+	Cursor    string    `json:"cursor,omitempty"` // 下次获取的游标，使用游标翻页的接口有效
+	UpdatedAt time.Time `json:"updated_at"`
+
+	DailyBudget   int `json:"daily_budget,omitempty"`
+	MonthlyBudget int `json:"monthly_budget,omitempty"`
+}
+
+// roll 日期或月份变化时清零对应的用量，剩余积分可能已经恢复，改为未知，由下次请求重新获取
+func (s *CreditState) roll(now time.Time) {
+	if day := now.Format(creditDayLayout); s.Day != day {
+		s.Day, s.UsedDay, s.Remaining = day, 0, -1
+	}
+	if month := now.Format(creditMonthLayout); s.Month != month {
+		s.Month, s.UsedMonth = month, 0
+	}
+}
+
+// CreditStore 保存所有搜索引擎数据源的积分用量与翻页进度，每次变化后写入文件，重启后继续
+type CreditStore struct {
+	path   string
+	mu     sync.Mutex
+	states map[string]*CreditState
+}
+
+// NewCreditStore 创建积分存储并加载已保存的状态，path 为空时只保存在内存中
+func NewCreditStore(path string) (*CreditStore, error) {
+	s := &CreditStore{path: path, states: make(map[string]*CreditState)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 加载已保存的状态，文件不存在时忽略
+func (s *CreditStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read source credits: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		return fmt.Errorf("failed to parse source credits: %v", err)
+	}
+	if s.states == nil {
+		s.states = make(map[string]*CreditState)
+	}
+	return nil
+}
+
+// save 写入文件，调用方需持有锁
+func (s *CreditStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.states, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	// 先写临时文件再重命名，避免写入中途退出导致文件损坏
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write source credits: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// stateFor 返回数据源的状态，不存在时创建，调用方需持有锁
+func (s *CreditStore) stateFor(name string, now time.Time) *CreditState {
+	st, ok := s.states[name]
+	if !ok {
+		st = &CreditState{Remaining: -1}
+		s.states[name] = st
+	}
+	st.roll(now)
+	return st
+}
+
+// Credits 返回数据源的积分记录，daily、monthly 为每天与每月的积分预算，0 表示不限制
+func (s *CreditStore) Credits(name string, daily, monthly int) *Credits {
+	if s == nil {
+		return nil
+	}
+	return &Credits{store: s, name: name, daily: daily, monthly: monthly}
+}
+
+// Credits 一个数据源的积分预算与翻页进度，nil 表示不限制也不记录
+type Credits struct {
+	store   *CreditStore
+	name    string
+	daily   int
+	monthly int
+}
+
+// Allow 检查本次请求预计消耗的积分是否超出预算或接口返回的剩余积分
+func (c *Credits) Allow(cost int) error {
+	if c == nil {
+		return nil
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	st := c.store.stateFor(c.name, time.Now())
+	switch {
+	case c.daily > 0 && st.UsedDay+cost > c.daily:
+		return fmt.Errorf("%w: used %d of daily budget %d", ErrBudgetExhausted, st.UsedDay, c.daily)
+	case c.monthly > 0 && st.UsedMonth+cost > c.monthly:
+		return fmt.Errorf("%w: used %d of monthly budget %d", ErrBudgetExhausted, st.UsedMonth, c.monthly)
+	case st.Remaining == 0:
+		return fmt.Errorf("%w: no credits remaining", ErrBudgetExhausted)
+	}
+	return nil
+}
+
+// Spend 记录本次请求消耗的积分，remaining 为接口返回的剩余积分，小于 0 表示接口未提供
+func (c *Credits) Spend(used, remaining int) error {
+	if c == nil {
+		return nil
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	now := time.Now()
+	st := c.store.stateFor(c.name, now)
+	st.UsedDay += used
+	st.UsedMonth += used
+	if remaining >= 0 {
+		st.Remaining = remaining
+	}
+	st.UpdatedAt = now
+	return c.store.save()
+}
+
+// Resume 返回上次停止的页码与游标，window(查询语句与时间窗口)变化时从第一页开始
+func (c *Credits) Resume(window string) (int, string) {
+	if c == nil {
+		return 1, ""
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	st := c.store.stateFor(c.name, time.Now())
+	if st.Window != window || st.Page < 1 {
+		return 1, ""
+	}
+	return st.Page, st.Cursor
+}
+
+// Advance 记录下次获取的页码与游标，page 为 1 且游标为空表示已取完，下次从头开始
+func (c *Credits) Advance(window string, page int, cursor string) error {
+	if c == nil {
+		return nil
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	now := time.Now()
+	st := c.store.stateFor(c.name, now)
+	st.Window, st.Page, st.Cursor = window, page, cursor
+	st.UpdatedAt = now
+	return c.store.save()
+}
+
+// State 返回当前的积分用量与翻页进度
+func (c *Credits) State() CreditState {
+	if c == nil {
+		return CreditState{Remaining: -1}
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	st := *c.store.stateFor(c.name, time.Now())
+	st.DailyBudget, st.MonthlyBudget = c.daily, c.monthly
+	return st
+}
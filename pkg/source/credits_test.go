@@ -0,0 +1,64 @@
+package source
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreditsRemainingRecoversAfterRoll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credits.json")
+	store, err := NewCreditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits := store.Credits("hunter", 0, 0)
+	if err := credits.Spend(10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := credits.Allow(1); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("Allow() = %v, want budget exhausted", err)
+	}
+
+	// 把保存的状态改到前一天，重启后剩余积分应变为未知
+	store.mu.Lock()
+	store.states["hunter"].Day = time.Now().AddDate(0, 0, -1).Format(creditDayLayout)
+	if err := store.save(); err != nil {
+		t.Fatal(err)
+	}
+	store.mu.Unlock()
+
+	store, err = NewCreditStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits = store.Credits("hunter", 0, 0)
+	if err := credits.Allow(1); err != nil {
+		t.Fatalf("Allow() after roll = %v", err)
+	}
+	if st := credits.State(); st.Remaining != -1 || st.UsedDay != 0 {
+		t.Errorf("remaining = %d, used = %d, want -1 and 0", st.Remaining, st.UsedDay)
+	}
+}
+
+func TestCreditsBudget(t *testing.T) {
+	store, _ := NewCreditStore("")
+	credits := store.Credits("fofa", 10, 15)
+	if err := credits.Allow(10); err != nil {
+		t.Fatalf("Allow(10) = %v", err)
+	}
+	_ = credits.Spend(8, -1)
+	if err := credits.Allow(3); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Allow(3) over daily budget = %v", err)
+	}
+
+	// 第二天的日预算恢复，月预算仍然累计
+	store.states["fofa"].Day = time.Now().AddDate(0, 0, -1).Format(creditDayLayout)
+	if err := credits.Allow(7); err != nil {
+		t.Errorf("Allow(7) on the next day = %v", err)
+	}
+	if err := credits.Allow(8); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Allow(8) over monthly budget = %v", err)
+	}
+}
@@ -3,16 +3,16 @@ package source
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"fmt"
 	"github.com/antchfx/htmlquery"
-	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/retryablehttp-go"
 	"github.com/tidwall/gjson"
 	"github.com/wjlin0/deadpool/pkg/types"
 	"io"
+	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type CustomSource struct {
@@ -22,7 +22,8 @@ type CustomSource struct {
 	headers      map[string]string
 	body         string
 	proxyConfig  *types.ProxyExtractConfig
-	responseType string // "json" 或 "text"
+	lineFormat   types.LineFormat // type 为 text 时每行的格式，scheme 同时作为其他类型缺少协议字段时的默认协议
+	responseType string           // json、text、xpath、regex 或 csv
 	enablePaging bool
 	currentPage  int
 	pageSize     int
@@ -36,6 +37,7 @@ func NewCustomSource(
 	headers map[string]string,
 	body string,
 	proxyConfig *types.ProxyExtractConfig,
+	lineFormat types.LineFormat,
 	responseType string,
 	timeout int,
 	enablePaging bool,
@@ -48,6 +50,7 @@ func NewCustomSource(
 		headers:      headers,
 		body:         body,
 		proxyConfig:  proxyConfig,
+		lineFormat:   lineFormat,
 		responseType: responseType,
 		enablePaging: enablePaging,
 		currentPage:  1,
@@ -58,10 +61,10 @@ func NewCustomSource(
 
 func (c *CustomSource) Fetch(ctx context.Context) (<-chan string, error) {
 	proxyChan := make(chan string)
-	c.lastFetchTime = time.Now()
+	c.markFetched()
 	go func() {
 		defer func() {
-			gologger.Debug().Msgf("关闭%s自定义代理通道", c.Name())
+			c.Logger().Debugf("关闭%s自定义代理通道", c.Name())
 			close(proxyChan)
 		}()
 
@@ -93,7 +96,7 @@ func (c *CustomSource) Fetch(ctx context.Context) (<-chan string, error) {
 
 			req, err := retryablehttp.NewRequestWithContext(ctx, c.method, endpoint, strings.NewReader(body))
 			if err != nil {
-				gologger.Warning().Msgf("创建请求失败: %v", err)
+				c.fail(fmt.Errorf("创建请求失败: %v", err))
 				return
 			}
 
@@ -101,11 +104,11 @@ func (c *CustomSource) Fetch(ctx context.Context) (<-chan string, error) {
 				req.Header.Set(key, value)
 			}
 
-			gologger.Info().Msgf("发送请求: %s %s (Page: %d)", c.method, endpoint, c.currentPage)
+			c.Logger().Infof("发送请求: %s %s (Page: %d)", c.method, endpoint, c.currentPage)
 
 			resp, err := client.Do(req)
 			if err != nil {
-				gologger.Warning().Msgf("请求失败: %v", err)
+				c.fail(fmt.Errorf("请求失败: %v", err))
 				return
 			}
 
@@ -117,12 +120,21 @@ func (c *CustomSource) Fetch(ctx context.Context) (<-chan string, error) {
 				proxyCount = c.extractProxiesFromText(resp.Body, proxyChan, ctx)
 			case "xpath":
 				proxyCount = c.extractProxiesFromXpath(resp.Body, proxyChan, ctx)
+			case "regex":
+				proxyCount = c.extractProxiesFromRegex(resp.Body, proxyChan, ctx)
+			case "csv":
+				proxyCount = c.extractProxiesFromCSV(resp.Body, proxyChan, ctx)
 			default:
-				gologger.Warning().Msgf("不支持的响应类型: %s", c.responseType)
+				c.fail(fmt.Errorf("不支持的响应类型: %s", c.responseType))
 				resp.Body.Close()
 				return
 			}
 			resp.Body.Close()
+			c.ReportSuccess()
+			// 消费方已取够代理并取消，不再请求下一页
+			if ctx.Err() != nil {
+				return
+			}
 
 			// If pagination is disabled or no proxies were found in this page, break the loop
 			if !c.enablePaging || proxyCount == 0 || totalCount >= c.maxSize {
@@ -142,63 +154,56 @@ func (c *CustomSource) Fetch(ctx context.Context) (<-chan string, error) {
 func (c *CustomSource) extractProxiesFromJSON(body io.Reader, proxyChan chan<- string, ctx context.Context) int {
 	data, err := io.ReadAll(body)
 	if err != nil {
-		gologger.Warning().Msgf("读取响应失败: %v", err)
+		c.Logger().Warningf("读取响应失败: %v", err)
 		return 0
 	}
 	proxyList := gjson.GetBytes(data, c.proxyConfig.ProxyListPath)
 	if !proxyList.Exists() {
-		gologger.Warning().Msgf("未找到代理列表，路径: %s", c.proxyConfig.ProxyListPath)
+		c.Logger().Warningf("未找到代理列表，路径: %s", c.proxyConfig.ProxyListPath)
+		return 0
+	}
+
+	// 列表中的字符串元素按文本行规范化，对象元素按字段组装
+	normalizer, err := NewNormalizer(nil, c.lineFormat.Scheme)
+	if err != nil {
+		c.Logger().Warningf("代理格式配置无效: %v", err)
 		return 0
 	}
+	defer func() { c.reportRejected(normalizer.Rejected()) }()
+
+	field := func(proxy gjson.Result, path string) string {
+		if path == "" {
+			return ""
+		}
+		return strings.TrimSpace(proxy.Get(path).String())
+	}
 
 	count := 0
 	proxyList.ForEach(func(_, proxy gjson.Result) bool {
+		var (
+			proxyAddr string
+			ok        bool
+		)
+		if proxy.Type == gjson.String {
+			proxyAddr, ok = normalizer.Normalize(proxy.Str)
+		} else {
+			proxyAddr, ok = normalizer.fromFields(
+				field(proxy, c.proxyConfig.SchemeField),
+				field(proxy, c.proxyConfig.IPField),
+				field(proxy, c.proxyConfig.PortField),
+				field(proxy, c.proxyConfig.UserField),
+				field(proxy, c.proxyConfig.PasswordField),
+			)
+		}
+		if !ok {
+			return true
+		}
 		select {
 		case <-ctx.Done():
 			return false
-		default:
-			if proxy.Type == 3 {
-				proxyStr := proxy.Str
-				if strings.Contains(proxyStr, "://") {
-					protocol := strings.Split(proxyStr, "://")[0]
-					if protocol != "socks5" {
-						return true
-					}
-					proxyStr = strings.Split(proxyStr, "://")[1]
-
-				} else {
-					proxyStr = fmt.Sprintf("socks5://%s", proxyStr)
-				}
-
-				proxyChan <- proxyStr
-				count++
-				return true
-			} else {
-				ip := proxy.Get(c.proxyConfig.IPField).String()
-				port := proxy.Get(c.proxyConfig.PortField).String()
-
-				username := proxy.Get(c.proxyConfig.UserField).String()
-				password := proxy.Get(c.proxyConfig.PasswordField).String()
-
-				if ip == "" || port == "" {
-					gologger.Debug().Msgf("跳过无效代理: ip=%q, port=%q", ip, port)
-					return true
-				}
-				proxyAddr := ""
-
-				switch {
-				case username == "" && password == "":
-					proxyAddr = fmt.Sprintf("socks5://%s:%s", ip, port)
-				default:
-					proxyAddr = fmt.Sprintf("socks5://%s:%s@%s:%s", username, password, ip, port)
-
-				}
-
-				proxyChan <- proxyAddr
-				count++
-				return true
-			}
-
+		case proxyChan <- proxyAddr:
+			count++
+			return true
 		}
 	})
 	return count
@@ -209,31 +214,28 @@ func (c *CustomSource) extractProxiesFromJSON(body io.Reader, proxyChan chan<- s
 func (c *CustomSource) extractProxiesFromText(body io.Reader, proxyChan chan<- string, ctx context.Context) int {
 	data, err := io.ReadAll(body)
 	if err != nil {
-		gologger.Warning().Msgf("读取响应失败: %v", err)
+		c.Logger().Warningf("读取响应失败: %v", err)
 		return 0
 	}
 
+	normalizer, err := NewNormalizer(c.lineFormat.Formats, c.lineFormat.Scheme)
+	if err != nil {
+		c.Logger().Warningf("代理格式配置无效: %v", err)
+		return 0
+	}
+	defer func() { c.reportRejected(normalizer.Rejected()) }()
+
 	count := 0
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
+		proxy, ok := normalizer.Normalize(line)
+		if !ok {
+			continue
+		}
 		select {
 		case <-ctx.Done():
 			return count
-		default:
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-			if strings.Contains(line, "://") {
-				protocal := strings.Split(line, "://")[0]
-				if protocal != "socks5" {
-					gologger.Debug().Msgf("跳过非 socks5 代理: %s", line)
-					continue
-				}
-				line = strings.Split(line, "://")[1]
-			}
-
-			proxyChan <- fmt.Sprintf("socks5://%s", line)
+		case proxyChan <- proxy:
 			count++
 		}
 	}
@@ -244,67 +246,194 @@ func (c *CustomSource) extractProxiesFromXpath(body io.Reader, proxyChan chan<-
 
 	data, err := io.ReadAll(body)
 	if err != nil {
-		gologger.Warning().Msgf("读取响应失败: %v", err)
+		c.Logger().Warningf("读取响应失败: %v", err)
 		return 0
 	}
 	pathNode, err := htmlquery.Parse(bytes.NewBuffer(data))
 	if err != nil {
-		gologger.Warning().Msgf("解析响应失败: %v", err)
+		c.Logger().Warningf("解析响应失败: %v", err)
 		return 0
 	}
 	// fmt.Println(string(data))
 
 	doc, err := htmlquery.QueryAll(pathNode, c.proxyConfig.ProxyListPath)
 	if err != nil {
-		gologger.Warning().Msgf("读取响应失败: %v", err)
+		c.Logger().Warningf("读取响应失败: %v", err)
+		return 0
+	}
+
+	normalizer, err := NewNormalizer(nil, c.lineFormat.Scheme)
+	if err != nil {
+		c.Logger().Warningf("代理格式配置无效: %v", err)
 		return 0
 	}
+	defer func() { c.reportRejected(normalizer.Rejected()) }()
 
 	count := 0
 	for _, node := range doc {
+		// field 取出节点下 expr 对应的文本，expr 为空或没有匹配的节点时返回空
+		field := func(expr string) string {
+			if expr == "" {
+				return ""
+			}
+			if n := htmlquery.FindOne(node, expr); n != nil {
+				return strings.TrimSpace(htmlquery.InnerText(n))
+			}
+			return ""
+		}
+		proxyAddr, ok := normalizer.fromFields(
+			field(c.proxyConfig.SchemeField),
+			field(c.proxyConfig.IPField),
+			field(c.proxyConfig.PortField),
+			field(c.proxyConfig.UserField),
+			field(c.proxyConfig.PasswordField),
+		)
+		if !ok {
+			continue
+		}
 		select {
 		case <-ctx.Done():
-			return 0
-		default:
-			ipNode := htmlquery.FindOne(node, c.proxyConfig.IPField)
-			if ipNode == nil {
-				continue
-			}
-			ip := strings.TrimSpace(htmlquery.InnerText(ipNode))
+			return count
+		case proxyChan <- proxyAddr:
+			count++
+		}
+	}
+	return count
+}
 
-			portNode := htmlquery.FindOne(node, c.proxyConfig.PortField)
-			if portNode == nil {
-				continue
-			}
-			port := strings.TrimSpace(htmlquery.InnerText(portNode))
-			username := ""
-			usernameNode := htmlquery.FindOne(node, c.proxyConfig.UserField)
-			if usernameNode != nil {
-				username = strings.TrimSpace(htmlquery.InnerText(usernameNode))
-			}
-			password := ""
-			passwordNode := htmlquery.FindOne(node, c.proxyConfig.PasswordField)
-			if passwordNode != nil {
-				password = strings.TrimSpace(htmlquery.InnerText(passwordNode))
-			}
+// extractProxiesFromRegex 用正则表达式的命名分组从响应中提取代理，分组名由 ipField、portField 等指定
+// 返回提取到的代理数量
+func (c *CustomSource) extractProxiesFromRegex(body io.Reader, proxyChan chan<- string, ctx context.Context) int {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		c.Logger().Warningf("读取响应失败: %v", err)
+		return 0
+	}
+	re, err := regexp.Compile(c.proxyConfig.ProxyListPath)
+	if err != nil {
+		c.Logger().Warningf("正则表达式无效: %v", err)
+		return 0
+	}
+	normalizer, err := NewNormalizer(nil, c.lineFormat.Scheme)
+	if err != nil {
+		c.Logger().Warningf("代理格式配置无效: %v", err)
+		return 0
+	}
+	defer func() { c.reportRejected(normalizer.Rejected()) }()
 
-			if ip == "" || port == "" {
-				gologger.Debug().Msgf("跳过无效代理: ip=%q, port=%q", ip, port)
+	group := func(m []string, name string) string {
+		if i := re.SubexpIndex(name); name != "" && i >= 0 {
+			return strings.TrimSpace(m[i])
+		}
+		return ""
+	}
+	count := 0
+	for _, m := range re.FindAllStringSubmatch(string(data), -1) {
+		proxy, ok := normalizer.fromFields(group(m, c.proxyConfig.SchemeField), group(m, c.proxyConfig.IPField), group(m, c.proxyConfig.PortField), group(m, c.proxyConfig.UserField), group(m, c.proxyConfig.PasswordField))
+		if !ok {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return count
+		case proxyChan <- proxy:
+			count++
+		}
+	}
+	return count
+}
+
+// extractProxiesFromCSV 从 CSV 响应中提取代理，ipField 与 portField 都是列号时没有表头，否则按第一行的表头查找列(忽略大小写)
+// 返回提取到的代理数量
+func (c *CustomSource) extractProxiesFromCSV(body io.Reader, proxyChan chan<- string, ctx context.Context) int {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		c.Logger().Warningf("读取响应失败: %v", err)
+		return 0
+	}
+	normalizer, err := NewNormalizer(nil, c.lineFormat.Scheme)
+	if err != nil {
+		c.Logger().Warningf("代理格式配置无效: %v", err)
+		return 0
+	}
+	defer func() { c.reportRejected(normalizer.Rejected()) }()
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = csvDelimiter(text)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	fields := []string{c.proxyConfig.SchemeField, c.proxyConfig.IPField, c.proxyConfig.PortField, c.proxyConfig.UserField, c.proxyConfig.PasswordField}
+	columns := make([]int, len(fields))
+	for i, f := range fields {
+		columns[i] = -1
+		if n, err := strconv.Atoi(f); err == nil {
+			columns[i] = n
+		}
+	}
+	// ip 与 port 都是列号时没有表头，其余按列名指定的字段被忽略
+	if columns[1] < 0 || columns[2] < 0 {
+		header, err := r.Read()
+		if err != nil {
+			c.Logger().Warningf("读取 CSV 表头失败: %v", err)
+			return 0
+		}
+		for i, f := range fields {
+			if columns[i] >= 0 || f == "" {
 				continue
 			}
-			proxyAddr := ""
-
-			switch {
-			case username == "" && password == "":
-				proxyAddr = fmt.Sprintf("socks5://%s:%s", ip, port)
-			default:
-				proxyAddr = fmt.Sprintf("socks5://%s:%s@%s:%s", username, password, ip, port)
-
+			for j, name := range header {
+				if strings.EqualFold(strings.TrimSpace(name), f) {
+					columns[i] = j
+					break
+				}
 			}
+		}
+		if columns[1] < 0 || columns[2] < 0 {
+			c.Logger().Warningf("CSV 表头中没有 %s 或 %s 列: %v", c.proxyConfig.IPField, c.proxyConfig.PortField, header)
+			return 0
+		}
+	}
 
-			proxyChan <- proxyAddr
+	count := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return count
+		}
+		if err != nil {
+			c.Logger().Warningf("解析 CSV 失败: %v", err)
+			return count
+		}
+		values := make([]string, len(columns))
+		for i, col := range columns {
+			if col >= 0 && col < len(record) {
+				values[i] = strings.TrimSpace(record[col])
+			}
+		}
+		proxy, ok := normalizer.fromFields(values[0], values[1], values[2], values[3], values[4])
+		if !ok {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return count
+		case proxyChan <- proxy:
 			count++
 		}
 	}
-	return count
+}
+
+// csvDelimiter 按第一行判断 CSV 的分隔符，默认为逗号
+func csvDelimiter(text string) rune {
+	first, _, _ := strings.Cut(text, "\n")
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if strings.ContainsRune(first, d) {
+			return d
+		}
+	}
+	return ','
 }
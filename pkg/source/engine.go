@@ -0,0 +1,128 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// newEngineClient 创建查询搜索引擎接口使用的 HTTP 客户端
+func newEngineClient() *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:    10,
+			IdleConnTimeout: 60 * time.Second,
+		},
+	}
+}
+
+// schemeFor 把搜索引擎识别的协议映射为上游代理的 scheme，代理池只支持 SOCKS5，其余协议返回空
+// 搜索引擎对 SOCKS 的命名各不相同，如 socks5、SOCKS、socks5-proxy
+func schemeFor(protocol string) string {
+	p := strings.ToLower(strings.TrimSpace(protocol))
+	switch {
+	case p == "socks", strings.HasPrefix(p, "socks5"):
+		return "socks5"
+	}
+	return ""
+}
+
+// waitPage 翻页前等待，ctx 取消时返回 false
+func waitPage(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// disable 标记源为 failing 并记录原因，用于认证失败与积分耗尽等短时间内重试没有意义的错误
+func (b *BaseSource) disable(reason string) {
+	b.Logger().Warningf("%s is unavailable: %s", b.Name(), reason)
+	b.SetUnavailable(reason)
+}
+
+// SetBudget 设置搜索引擎数据源的积分记录与翻页间隔，pageDelay 为 0 时使用数据源的默认值
+func (b *BaseSource) SetBudget(credits *Credits, pageDelay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.credits = credits
+	b.pageDelay = pageDelay
+}
+
+// CreditState 返回积分用量与翻页进度，未设置积分记录时返回 false
+func (b *BaseSource) CreditState() (CreditState, bool) {
+	b.mu.RLock()
+	credits := b.credits
+	b.mu.RUnlock()
+	if credits == nil {
+		return CreditState{}, false
+	}
+	return credits.State(), true
+}
+
+// budget 返回积分记录与翻页间隔，未设置翻页间隔时返回 def
+func (b *BaseSource) budget(def time.Duration) (*Credits, time.Duration) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.pageDelay > 0 {
+		return b.credits, b.pageDelay
+	}
+	return b.credits, def
+}
+
+// allowPage 检查下一页预计消耗的积分是否超出预算，超出时记录日志并返回 false
+func (b *BaseSource) allowPage(credits *Credits, cost int) bool {
+	if err := credits.Allow(cost); err != nil {
+		b.Logger().Infof("%s stops fetching: %v", b.Name(), err)
+		return false
+	}
+	return true
+}
+
+// spend 记录本页消耗的积分，remaining 小于 0 表示接口未返回剩余积分
+func (b *BaseSource) spend(credits *Credits, used, remaining int) {
+	if err := credits.Spend(used, remaining); err != nil {
+		b.Logger().Warningf("save %s credits error: %v", b.Name(), err)
+	}
+}
+
+// advance 记录下次获取的页码与游标
+func (b *BaseSource) advance(credits *Credits, window string, page int, cursor string) {
+	if err := credits.Advance(window, page, cursor); err != nil {
+		b.Logger().Warningf("save %s credits error: %v", b.Name(), err)
+	}
+}
+
+// accountInfo 查询搜索引擎的账户信息接口并解析到 v，ref 为相对搜索接口地址的路径，如 ../info/my
+// 账户信息接口不扣除积分，用于获取剩余积分
+func accountInfo(ctx context.Context, client *http.Client, endpoint, ref string, params url.Values, header http.Header, v any) error {
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	u := base.ResolveReference(&url.URL{Path: ref})
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("query account info error: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,34 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readFixture 读取 testdata 中录制的接口响应
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSchemeFor(t *testing.T) {
+	tests := map[string]string{
+		"socks5":       "socks5",
+		"SOCKS":        "socks5",
+		" Socks5 ":     "socks5",
+		"socks5-proxy": "socks5",
+		"socks4":       "",
+		"http":         "",
+		"":             "",
+	}
+	for protocol, want := range tests {
+		if got := schemeFor(protocol); got != want {
+			t.Errorf("schemeFor(%q) = %q, want %q", protocol, got, want)
+		}
+	}
+}
@@ -2,36 +2,91 @@ package source
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/wjlin0/deadpool/pkg/types"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
-// FileSource 实现Source接口
+// fileWatchDebounce 文件连续变化时合并为一次通知的等待时间
+const fileWatchDebounce = 500 * time.Millisecond
+
+// FileSource 实现Source接口，从一个或多个文件读取代理，支持目录、通配符与 gzip 压缩的文件
 type FileSource struct {
 	*BaseSource
-	filePath string
+	paths  []string
+	format types.LineFormat
 }
 
-// NewFileSource 创建新的文件源
-func NewFileSource(filePath string, timeout int) *FileSource {
+// NewFileSource 创建新的文件源，paths 可以是文件、目录(读取目录下的所有文件)或通配符，format 为每行的格式
+func NewFileSource(paths []string, format types.LineFormat, timeout int) *FileSource {
 	return &FileSource{
 		BaseSource: NewBaseSource("file", timeout),
-		filePath:   filePath,
+		paths:      paths,
+		format:     format,
 	}
 }
 
-// Name 返回源名称
-func (f *FileSource) Name() string {
-	return f.name
+// files 返回当前匹配的所有文件，按路径排序并去重
+func (f *FileSource) files() ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, p := range f.paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %v", p, err)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				if !seen[match] {
+					seen[match] = true
+					files = append(files, match)
+				}
+				continue
+			}
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				name := filepath.Join(match, e.Name())
+				if e.Type().IsRegular() && !seen[name] {
+					seen[name] = true
+					files = append(files, name)
+				}
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proxy file matched %s", strings.Join(f.paths, ", "))
+	}
+	sort.Strings(files)
+	return files, nil
 }
 
 // Fetch 从文件读取代理列表，返回一个通道
 func (f *FileSource) Fetch(ctx context.Context) (<-chan string, error) {
-	f.lastFetchTime = time.Now()
-	file, err := os.Open(f.filePath)
+	f.markFetched()
+	files, err := f.files()
 	if err != nil {
+		f.ReportFailure(err)
+		return nil, err
+	}
+	normalizer, err := NewNormalizer(f.format.Formats, f.format.Scheme)
+	if err != nil {
+		f.ReportFailure(err)
 		return nil, err
 	}
 
@@ -39,34 +94,221 @@ func (f *FileSource) Fetch(ctx context.Context) (<-chan string, error) {
 
 	go func() {
 		defer close(proxyChan)
-		defer file.Close()
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
+		seen := make(map[string]bool)
+		var errs []error
+		for _, name := range files {
+			err := readProxyFile(name, normalizer, func(proxy string) bool {
+				if seen[proxy] {
+					return true
+				}
+				seen[proxy] = true
+				select {
+				case <-ctx.Done(): // 监听取消信号
+					return false
+				case proxyChan <- proxy:
+					return true
+				}
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		f.reportRejected(normalizer.Rejected())
+		if len(errs) > 0 {
+			f.fail(errors.Join(errs...))
+			return
+		}
+		f.ReportSuccess()
+	}()
+	return proxyChan, nil
+}
+
+// Snapshot 读取所有文件并返回当前的完整代理列表，任一文件读取失败时返回错误
+func (f *FileSource) Snapshot() ([]string, error) {
+	files, err := f.files()
+	if err != nil {
+		return nil, err
+	}
+	normalizer, err := NewNormalizer(f.format.Formats, f.format.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	var proxies []string
+	for _, name := range files {
+		if err := readProxyFile(name, normalizer, func(proxy string) bool {
+			proxies = append(proxies, proxy)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return proxies, nil
+}
+
+// Watch 监听文件的变化，连续的变化合并后调用一次 onChange，ctx 取消后停止
+func (f *FileSource) Watch(ctx context.Context, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听所在目录而不是文件本身，编辑器保存时常以重命名方式替换文件，目录下也可能新增匹配的文件
+	patterns := make([]string, 0, len(f.paths))
+	for _, p := range f.paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			_ = watcher.Close()
+			return err
+		}
+		patterns = append(patterns, abs)
+	}
+	// addWatches 监听所有通配符当前匹配的目录，目录中的通配符可能匹配到新建的目录，目录变化后再次调用
+	addWatches := func() int {
+		watched := 0
+		for _, p := range patterns {
+			for _, dir := range watchDirs(p) {
+				if err := watcher.Add(dir); err != nil {
+					f.Logger().Warningf("failed to watch %s: %v", dir, err)
+					continue
+				}
+				watched++
+			}
+		}
+		return watched
+	}
+	if addWatches() == 0 {
+		_ = watcher.Close()
+		return fmt.Errorf("no directory to watch for %s", strings.Join(f.paths, ", "))
+	}
+
+	matches := func(name string) bool {
+		for _, p := range patterns {
+			if ok, _ := filepath.Match(p, name); ok || filepath.Dir(name) == p {
+				return true
+			}
+			// 通配符匹配到的目录中的文件
+			if ok, _ := filepath.Match(p, filepath.Dir(name)); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
 			select {
-			case <-ctx.Done(): // 监听取消信号
+			case <-ctx.Done():
 				return
-			default:
-				line := strings.TrimSpace(scanner.Text())
-				if line != "" && !strings.HasPrefix(line, "#") {
-					proxyChan <- line
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				if event.Has(fsnotify.Create) {
+					// 新建或移入的目录可能被通配符匹配，开始监听并重新读取
+					if info, err := os.Stat(name); err == nil && info.IsDir() {
+						addWatches()
+						debounce = time.After(fileWatchDebounce)
+						continue
+					}
+				}
+				if matches(name) {
+					debounce = time.After(fileWatchDebounce)
 				}
+			case <-debounce:
+				debounce = nil
+				onChange()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				f.Logger().Warningf("failed to watch proxy files: %v", err)
 			}
 		}
 	}()
-	return proxyChan, nil
+	return nil
 }
 
-// IsAvailable 检查源是否可用
-func (f *FileSource) IsAvailable() bool {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-	return f.available
+// watchDirs 返回监听 pattern 需要的目录：pattern 本身是目录时为该目录，否则为文件所在的目录；
+// 目录中含有通配符时为每一级通配符当前匹配到的目录，以及最深的不含通配符的父目录，用于发现新建的目录
+func watchDirs(pattern string) []string {
+	var dirs []string
+	isDir := func(name string) bool {
+		info, err := os.Stat(name)
+		return err == nil && info.IsDir()
+	}
+	if !hasGlob(pattern) {
+		if isDir(pattern) {
+			return []string{pattern}
+		}
+		return []string{filepath.Dir(pattern)}
+	}
+	// 通配符匹配到的目录，读取其中的所有文件
+	if matches, err := filepath.Glob(pattern); err == nil {
+		for _, m := range matches {
+			if isDir(m) {
+				dirs = append(dirs, m)
+			}
+		}
+	}
+	for dir := filepath.Dir(pattern); ; dir = filepath.Dir(dir) {
+		if !hasGlob(dir) {
+			return append(dirs, dir)
+		}
+		matches, _ := filepath.Glob(dir)
+		for _, m := range matches {
+			if isDir(m) {
+				dirs = append(dirs, m)
+			}
+		}
+	}
 }
 
-// setAvailable 设置源可用状态(内部方法)
-func (f *FileSource) setAvailable(available bool) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	f.available = available
+// hasGlob 判断路径中是否含有通配符
+func hasGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// readProxyFile 逐行读取代理文件并由 normalizer 转换为代理 URL，gzip 压缩的文件自动解压
+// emit 返回 false 时停止读取
+func readProxyFile(name string, normalizer *Normalizer, emit func(proxy string) bool) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = bufio.NewReader(file)
+	// 按文件头识别 gzip，不依赖扩展名
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// 每个文件可以有自己的 CSV 表头
+	normalizer.resetHeader()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		proxy, ok := normalizer.Normalize(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !emit(proxy) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
 }
@@ -0,0 +1,234 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FOFA 支持返回的字段，ip 与 port 必须返回
+var FofaFields = []string{"ip", "port", "protocol"}
+
+type FofaSource struct {
+	*BaseSource
+	email    string
+	key      string
+	endpoint string
+	query    string
+	maxSize  int
+	pageSize int
+	fields   []string
+	days     int
+}
+
+func NewFofaSource(email, key, endpoint, query string, maxSize, pageSize int, fields []string, days int, timeout int) *FofaSource {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	if len(fields) == 0 {
+		fields = FofaFields
+	}
+	return &FofaSource{
+		BaseSource: NewBaseSource("fofa", timeout),
+		email:      email,
+		key:        key,
+		endpoint:   endpoint,
+		query:      query,
+		maxSize:    maxSize,
+		pageSize:   pageSize,
+		fields:     fields,
+		days:       days,
+	}
+}
+
+// fofaResponse FOFA 搜索接口的响应，results 的每一项按 fields 的顺序排列，只有一个字段时为字符串
+type fofaResponse struct {
+	Error   bool              `json:"error"`
+	ErrMsg  string            `json:"errmsg"`
+	Size    int               `json:"size"`
+	Page    int               `json:"page"`
+	Results []json.RawMessage `json:"results"`
+}
+
+func (f *FofaSource) Fetch(ctx context.Context) (<-chan string, error) {
+	proxyChan := make(chan string)
+
+	f.markFetched()
+
+	go func() {
+		defer close(proxyChan)
+
+		client := newEngineClient()
+
+		query := f.query
+		if f.days > 0 {
+			// FOFA 的 after 按资产的更新时间过滤
+			query = fmt.Sprintf(`(%s) && after="%s"`, query, time.Now().AddDate(0, 0, -f.days).Format("2006-01-02"))
+		}
+		qbase64 := base64.StdEncoding.EncodeToString([]byte(query))
+
+		credits, delay := f.budget(time.Second)
+		// 查询语句(含时间窗口)不变时从上次停止的页继续
+		window := query
+		page, _ := credits.Resume(window)
+		totalFetched := 0
+		for {
+			// FOFA 按返回的结果数扣除积分
+			if !f.allowPage(credits, f.pageSize) {
+				return
+			}
+
+			params := url.Values{}
+			if f.email != "" {
+				params.Set("email", f.email)
+			}
+			params.Set("key", f.key)
+			params.Set("qbase64", qbase64)
+			params.Set("fields", strings.Join(f.fields, ","))
+			params.Set("page", strconv.Itoa(page))
+			params.Set("size", strconv.Itoa(f.pageSize))
+
+			f.Logger().Infof("fetching page %d (%d per page) from %s", page, f.pageSize, f.endpoint)
+			req, err := http.NewRequestWithContext(ctx, "GET", f.endpoint+"?"+params.Encode(), nil)
+			if err != nil {
+				return
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				f.fail(fmt.Errorf("query fofa error: %v", err))
+				return
+			}
+			var result fofaResponse
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+				f.disable(fmt.Sprintf("authentication failed: %s %s", resp.Status, result.ErrMsg))
+				return
+			case err != nil:
+				f.fail(fmt.Errorf("query fofa error: %s: %v", resp.Status, err))
+				return
+			case result.Error:
+				if reason, ok := fofaFatalError(result.ErrMsg); ok {
+					f.disable(reason)
+				} else {
+					f.fail(fmt.Errorf("query fofa error: %s", result.ErrMsg))
+				}
+				return
+			}
+			f.ReportSuccess()
+			f.spend(credits, len(result.Results), f.remaining(ctx, client))
+
+			for _, raw := range result.Results {
+				// 本页还有未取的结果时不推进翻页进度，下次从本页继续，已经付费的结果不会丢失
+				if f.maxSize > 0 && totalFetched >= f.maxSize {
+					return
+				}
+				proxy, ok := f.parseResult(raw)
+				if !ok {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case proxyChan <- proxy:
+					totalFetched++
+				}
+			}
+
+			// 本页已全部取完才推进翻页进度
+			last := len(result.Results) < f.pageSize || page*f.pageSize >= result.Size
+			if last {
+				f.advance(credits, window, 1, "")
+			} else {
+				f.advance(credits, window, page+1, "")
+			}
+			// 已取完全部结果
+			if last || (f.maxSize > 0 && totalFetched >= f.maxSize) {
+				return
+			}
+			page++
+			if !waitPage(ctx, delay) {
+				return
+			}
+		}
+	}()
+
+	return proxyChan, nil
+}
+
+// remaining 查询账户本月剩余可获取的数据条数，FOFA 按返回的结果数扣除，查询失败时返回 -1
+func (f *FofaSource) remaining(ctx context.Context, client *http.Client) int {
+	params := url.Values{}
+	if f.email != "" {
+		params.Set("email", f.email)
+	}
+	params.Set("key", f.key)
+	var info struct {
+		Error         bool `json:"error"`
+		RemainAPIData *int `json:"remain_api_data"`
+	}
+	if err := accountInfo(ctx, client, f.endpoint, "../info/my", params, nil, &info); err != nil || info.Error || info.RemainAPIData == nil {
+		return -1
+	}
+	return *info.RemainAPIData
+}
+
+// parseResult 把一条结果转换为代理 URL，只保留 SOCKS5 代理
+func (f *FofaSource) parseResult(raw json.RawMessage) (string, bool) {
+	var values []string
+	if len(f.fields) == 1 {
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return "", false
+		}
+		values = []string{v}
+	} else if err := json.Unmarshal(raw, &values); err != nil {
+		return "", false
+	}
+
+	var ip, port, protocol string
+	for i, field := range f.fields {
+		if i >= len(values) {
+			break
+		}
+		switch field {
+		case "ip":
+			ip = values[i]
+		case "port":
+			port = values[i]
+		case "protocol":
+			protocol = values[i]
+		}
+	}
+	// 未选择 protocol 字段时由查询条件保证是 SOCKS5 代理
+	scheme := "socks5"
+	if protocol != "" {
+		scheme = schemeFor(protocol)
+	}
+	if ip == "" || port == "" || scheme == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%s://%s:%s", scheme, ip, port), true
+}
+
+// fofaFatalError 判断 FOFA 的错误信息是否为认证失败或积分耗尽，是时返回不可用的原因
+func fofaFatalError(msg string) (string, bool) {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(msg, "[-700]"), strings.Contains(msg, "[-702]"),
+		strings.Contains(lower, "account invalid"), strings.Contains(lower, "email invalid"), strings.Contains(lower, "key invalid"):
+		return "authentication failed: " + msg, true
+	case strings.Contains(msg, "[820031]"), strings.Contains(msg, "[820040]"),
+		strings.Contains(msg, "不足"), strings.Contains(lower, "insufficient"), strings.Contains(lower, "quota"):
+		return "quota exhausted: " + msg, true
+	}
+	return "", false
+}
@@ -0,0 +1,278 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect 读取通道中的全部代理
+func collect(t *testing.T, ch <-chan string) []string {
+	t.Helper()
+	var proxies []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p, ok := <-ch:
+			if !ok {
+				return proxies
+			}
+			proxies = append(proxies, p)
+		case <-timeout:
+			t.Fatal("fetch did not finish")
+		}
+	}
+}
+
+// fofaServer 按 page 与 size 参数分页返回 results，账户信息接口返回 remain 条剩余数据
+func fofaServer(t *testing.T, results [][]string, remain int, pages *[]int) *httptest.Server {
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/info/my", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "key" {
+			t.Errorf("unexpected account info query: %s", r.URL.RawQuery)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": false, "fofa_point": 0, "remain_api_query": 9990, "remain_api_data": remain})
+	})
+	mux.HandleFunc("/api/v1/search/all", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("key") != "key" || q.Get("email") != "me@example.com" {
+			t.Errorf("unexpected credentials: %s", r.URL.RawQuery)
+		}
+		if got := q.Get("fields"); got != "ip,port,protocol" {
+			t.Errorf("fields = %q", got)
+		}
+		query, _ := base64.StdEncoding.DecodeString(q.Get("qbase64"))
+		if string(query) != `protocol=="socks5"` {
+			t.Errorf("query = %q", query)
+		}
+		page, _ := strconv.Atoi(q.Get("page"))
+		size, _ := strconv.Atoi(q.Get("size"))
+		mu.Lock()
+		*pages = append(*pages, page)
+		mu.Unlock()
+
+		start, end := (page-1)*size, page*size
+		if start > len(results) {
+			start = len(results)
+		}
+		if end > len(results) {
+			end = len(results)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"error":   false,
+			"size":    len(results),
+			"page":    page,
+			"results": results[start:end],
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestFofa(endpoint string, maxSize, pageSize int, fields []string) *FofaSource {
+	f := NewFofaSource("me@example.com", "key", endpoint+"/api/v1/search/all", `protocol=="socks5"`, maxSize, pageSize, fields, 0, 10)
+	f.SetBudget(nil, time.Millisecond)
+	return f
+}
+
+// fofaResults 返回 n 条 SOCKS5 结果与对应的代理 URL
+func fofaResults(n int) ([][]string, []string) {
+	var results [][]string
+	var proxies []string
+	for i := 1; i <= n; i++ {
+		results = append(results, []string{fmt.Sprintf("10.0.0.%d", i), "1080", "socks5"})
+		proxies = append(proxies, fmt.Sprintf("socks5://10.0.0.%d:1080", i))
+	}
+	return results, proxies
+}
+
+func TestFofaPaging(t *testing.T) {
+	results, want := fofaResults(5)
+	var pages []int
+	srv := fofaServer(t, results, 4321, &pages)
+	defer srv.Close()
+
+	store, _ := NewCreditStore("")
+	credits := store.Credits("fofa", 0, 0)
+	f := newTestFofa(srv.URL, 0, 2, nil)
+	f.SetBudget(credits, time.Millisecond)
+	ch, err := f.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, ch); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxies = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(pages, []int{1, 2, 3}) {
+		t.Errorf("pages = %v, want [1 2 3]", pages)
+	}
+	if h := f.Status().Health; h != HealthHealthy {
+		t.Errorf("health = %s, want healthy", h)
+	}
+	st := credits.State()
+	if st.UsedDay != 5 || st.Remaining != 4321 {
+		t.Errorf("used = %d, remaining = %d, want 5 and 4321", st.UsedDay, st.Remaining)
+	}
+	// 取完最后一页后回到第一页
+	if st.Page != 1 {
+		t.Errorf("next page = %d, want 1", st.Page)
+	}
+}
+
+func TestFofaMaxSizeKeepsPage(t *testing.T) {
+	results, all := fofaResults(5)
+	var pages []int
+	srv := fofaServer(t, results, 100, &pages)
+	defer srv.Close()
+
+	store, _ := NewCreditStore("")
+	credits := store.Credits("fofa", 0, 0)
+	f := newTestFofa(srv.URL, 3, 2, nil)
+	f.SetBudget(credits, time.Millisecond)
+
+	// 第 2 页只取了一条就达到 maxSize，进度停留在第 2 页
+	ch, _ := f.Fetch(context.Background())
+	if got := collect(t, ch); !reflect.DeepEqual(got, all[:3]) {
+		t.Errorf("first fetch = %v, want %v", got, all[:3])
+	}
+	if page := credits.State().Page; page != 2 {
+		t.Errorf("next page = %d, want 2", page)
+	}
+
+	// 下次从第 2 页继续，第 2 页未取的结果不会丢失
+	ch, _ = f.Fetch(context.Background())
+	if got := collect(t, ch); !reflect.DeepEqual(got, all[2:]) {
+		t.Errorf("second fetch = %v, want %v", got, all[2:])
+	}
+	if !reflect.DeepEqual(pages, []int{1, 2, 2, 3}) {
+		t.Errorf("pages = %v, want [1 2 2 3]", pages)
+	}
+	if page := credits.State().Page; page != 1 {
+		t.Errorf("next page = %d, want 1", page)
+	}
+}
+
+func TestFofaRemainingExhausted(t *testing.T) {
+	results, want := fofaResults(5)
+	var pages []int
+	srv := fofaServer(t, results, 0, &pages)
+	defer srv.Close()
+
+	store, _ := NewCreditStore("")
+	f := newTestFofa(srv.URL, 0, 2, nil)
+	f.SetBudget(store.Credits("fofa", 0, 0), time.Millisecond)
+	ch, _ := f.Fetch(context.Background())
+	// 账户信息返回剩余 0 条后不再翻页
+	if got := collect(t, ch); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("proxies = %v, want %v", got, want[:2])
+	}
+	if !reflect.DeepEqual(pages, []int{1}) {
+		t.Errorf("pages = %v, want [1]", pages)
+	}
+}
+
+func TestFofaParseResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		raw    string
+		want   string
+		ok     bool
+	}{
+		{"socks5", []string{"ip", "port", "protocol"}, `["1.2.3.4","1080","socks5"]`, "socks5://1.2.3.4:1080", true},
+		{"socks alias", []string{"ip", "port", "protocol"}, `["1.2.3.4","1080","SOCKS"]`, "socks5://1.2.3.4:1080", true},
+		{"http rejected", []string{"ip", "port", "protocol"}, `["1.2.3.4","8080","http"]`, "", false},
+		{"field order", []string{"port", "protocol", "ip"}, `["1080","socks5","1.2.3.4"]`, "socks5://1.2.3.4:1080", true},
+		{"no protocol field", []string{"ip", "port"}, `["1.2.3.4","1080"]`, "socks5://1.2.3.4:1080", true},
+		{"extra fields", []string{"ip", "port", "protocol", "country"}, `["1.2.3.4","1080","socks5","CN"]`, "socks5://1.2.3.4:1080", true},
+		{"single field", []string{"ip"}, `"1.2.3.4"`, "", false},
+		{"missing port", []string{"ip", "port", "protocol"}, `["1.2.3.4","","socks5"]`, "", false},
+		{"short row", []string{"ip", "port", "protocol"}, `["1.2.3.4"]`, "", false},
+		{"malformed", []string{"ip", "port"}, `{"ip":"1.2.3.4"}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFofa("", 0, 0, tt.fields)
+			got, ok := f.parseResult(json.RawMessage(tt.raw))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseResult(%s) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFofaAuthFailure(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{"error":true,"errmsg":"[-700] Account Invalid"}`))
+			}))
+			defer srv.Close()
+
+			f := newTestFofa(srv.URL, 0, 2, nil)
+			ch, err := f.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collect(t, ch); len(got) != 0 {
+				t.Errorf("proxies = %v, want none", got)
+			}
+			if h := f.Status().Health; h != HealthFailing {
+				t.Errorf("health = %s, want failing", h)
+			}
+			if reason := f.UnavailableReason(); !strings.HasPrefix(reason, "authentication failed") {
+				t.Errorf("reason = %q", reason)
+			}
+			if f.IsAvailable() {
+				t.Error("source is still available")
+			}
+		})
+	}
+}
+
+func TestFofaErrMsg(t *testing.T) {
+	tests := []struct {
+		errmsg string
+		health Health
+		reason string
+	}{
+		{"[820031] F点余额不足", HealthFailing, "quota exhausted"},
+		{"[820040] query api quota exceeded", HealthFailing, "quota exhausted"},
+		{"[-702] key invalid", HealthFailing, "authentication failed"},
+		{"[820000] query syntax error", HealthDegraded, "query fofa error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.errmsg, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": true, "errmsg": tt.errmsg})
+			}))
+			defer srv.Close()
+
+			f := newTestFofa(srv.URL, 0, 2, nil)
+			ch, err := f.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collect(t, ch); len(got) != 0 {
+				t.Errorf("proxies = %v, want none", got)
+			}
+			st := f.Status()
+			if st.Health != tt.health {
+				t.Errorf("health = %s, want %s", st.Health, tt.health)
+			}
+			if !strings.HasPrefix(st.LastError, tt.reason) {
+				t.Errorf("last error = %q, want prefix %q", st.LastError, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package source
+
+import (
+	"time"
+)
+
+// Health 代理源的健康状态
+type Health string
+
+const (
+	HealthHealthy  Health = "healthy"  // 最近一次获取成功
+	HealthDegraded Health = "degraded" // 连续失败次数较少，退避后重试
+	HealthFailing  Health = "failing"  // 连续失败或遇到认证失败、积分耗尽等错误，退避后重试
+)
+
+const (
+	// failingThreshold 连续失败达到该次数后进入 failing
+	failingThreshold = 3
+	// retryBaseDelay 第一次失败后的退避时间，之后每次失败翻倍
+	retryBaseDelay = time.Minute
+	// retryMaxDelay 退避时间的上限，认证失败与积分耗尽直接使用该值
+	retryMaxDelay = time.Hour
+)
+
+// Status 代理源的健康状态、最近的错误与下次重试的时间
+type Status struct {
+	Health              Health    `json:"health"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorTime       time.Time `json:"last_error_time"`   // 从未失败时为零值
+	LastSuccessTime     time.Time `json:"last_success_time"` // 从未成功时为零值
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	NextRetry           time.Time `json:"next_retry"` // 退避结束的时间，之前不会自动获取，没有退避时为零值
+	Rejected            int       `json:"rejected"`   // 最近一次获取中格式无法识别而被拒绝的条目数
+}
+
+// retryDelay 返回连续失败 n 次后的退避时间
+func retryDelay(n int) time.Duration {
+	d := retryBaseDelay
+	for i := 1; i < n && d < retryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d
+}
+
+// Status 返回代理源的健康状态(线程安全)
+func (b *BaseSource) Status() Status {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.status
+}
+
+// ReportSuccess 记录一次成功的获取，恢复为 healthy(线程安全)
+func (b *BaseSource) ReportSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.Health = HealthHealthy
+	b.status.LastSuccessTime = time.Now()
+	b.status.ConsecutiveFailures = 0
+	b.status.NextRetry = time.Time{}
+}
+
+// ReportFailure 记录一次失败的获取，按连续失败次数指数退避(线程安全)
+func (b *BaseSource) ReportFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.status.ConsecutiveFailures++
+	b.status.LastError = err.Error()
+	b.status.LastErrorTime = now
+	b.status.NextRetry = now.Add(retryDelay(b.status.ConsecutiveFailures))
+	if b.status.ConsecutiveFailures >= failingThreshold {
+		b.status.Health = HealthFailing
+	} else {
+		b.status.Health = HealthDegraded
+	}
+}
+
+// reportRejected 记录最近一次获取中被拒绝的条目数(线程安全)
+func (b *BaseSource) reportRejected(n int) {
+	if n > 0 {
+		b.Logger().Warningf("%s: rejected %d malformed entries", b.Name(), n)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.Rejected = n
+}
+
+// fail 记录一次失败的获取并输出日志
+func (b *BaseSource) fail(err error) {
+	b.Logger().Warningf("%s: %v", b.Name(), err)
+	b.ReportFailure(err)
+}
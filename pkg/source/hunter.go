@@ -5,9 +5,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"github.com/projectdiscovery/gologger"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,42 +18,57 @@ type HunterSource struct {
 	apiKey   string
 	endpoint string
 	maxSize  int
+	pageSize int
+	days     int
 	query    string
 }
 
-func NewHunterSource(apiKey, endpoint, query string, maxSize int, timeout int) *HunterSource {
+func NewHunterSource(apiKey, endpoint, query string, maxSize, pageSize, days int, timeout int) *HunterSource {
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	if days <= 0 {
+		days = 1
+	}
 	return &HunterSource{
 		BaseSource: NewBaseSource("hunter", timeout),
 		apiKey:     apiKey,
 		endpoint:   endpoint,
 		query:      query,
 		maxSize:    maxSize,
+		pageSize:   pageSize,
+		days:       days,
+	}
+}
+
+// hunterQuotaNumber 匹配 consume_quota、rest_quota 中的积分数，如 "今日剩余积分：490"
+var hunterQuotaNumber = regexp.MustCompile(`\d+`)
+
+// hunterQuota 解析 Hunter 返回的积分描述，没有数字时返回 -1
+func hunterQuota(s string) int {
+	n, err := strconv.Atoi(hunterQuotaNumber.FindString(s))
+	if err != nil {
+		return -1
 	}
+	return n
 }
 
 func (h *HunterSource) Fetch(ctx context.Context) (<-chan string, error) {
 	proxyChan := make(chan string)
 
-	h.lastFetchTime = time.Now()
+	h.markFetched()
 
 	go func() {
 		defer func() {
-			fmt.Println("关闭 proxyChan")
+			h.Logger().Debugf("关闭 proxyChan")
 			close(proxyChan)
 		}()
 
-		client := &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:    10,
-				IdleConnTimeout: 60 * time.Second,
-			},
-		}
+		client := newEngineClient()
+		credits, delay := h.budget(5 * time.Second)
 
-		page := 1
-		pageSize := 50
 		totalFetched := 0
-		startTime := time.Now().AddDate(0, 0, -1).Format("2006-01-02") // 7天前
+		startTime := time.Now().AddDate(0, 0, -h.days).Format("2006-01-02")
 
 		// 强制SOCKS5协议查询
 		baseQuery := `protocol="socks5"`
@@ -60,77 +77,106 @@ func (h *HunterSource) Fetch(ctx context.Context) (<-chan string, error) {
 		}
 		encodedSearch := base64.URLEncoding.EncodeToString([]byte(baseQuery))
 
+		// 查询语句与时间窗口不变时从上次停止的页继续，避免重复获取排在前面的结果
+		window := baseQuery + "|" + startTime
+		page, _ := credits.Resume(window)
+
 		for {
-			select {
-			case <-ctx.Done():
+			// Hunter 按返回的结果数扣除积分
+			if !h.allowPage(credits, h.pageSize) {
 				return
-			default:
-				// 直接使用 h.endpoint（假设已包含完整路径）
-				reqUrl := fmt.Sprintf("%s?search=%s&page=%d&page_size=%d&api-key=%s&start_time=%s",
-					h.endpoint, // 示例: "https://api.hunter.io/openApi/search"
-					encodedSearch,
-					page,
-					pageSize,
-					url.QueryEscape(h.apiKey),
-					startTime,
-				)
-
-				gologger.Info().Msg(reqUrl)
-
-				req, err := http.NewRequestWithContext(ctx, "GET", reqUrl, nil)
-				if err != nil {
-					return
-				}
+			}
 
-				resp, err := client.Do(req)
-				if err != nil {
-					return
-				}
+			// 直接使用 h.endpoint（假设已包含完整路径）
+			reqUrl := fmt.Sprintf("%s?search=%s&page=%d&page_size=%d&api-key=%s&start_time=%s",
+				h.endpoint, // 示例: "https://hunter.qianxin.com/openApi/search"
+				encodedSearch,
+				page,
+				h.pageSize,
+				url.QueryEscape(h.apiKey),
+				startTime,
+			)
 
-				// ...保持原有响应解析逻辑...
-				var result struct {
-					Code    int    `json:"code"`
-					Message string `json:"message"`
-					Data    struct {
-						Arr []struct {
-							IP       string `json:"ip"`
-							Port     int    `json:"port"`
-							Protocol string `json:"protocol"`
-						} `json:"arr"`
-					} `json:"data"`
-				}
+			h.Logger().Infof("fetching page %d (%d per page) from %s", page, h.pageSize, h.endpoint)
 
-				if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-					resp.Body.Close()
-					//h.SetAvailable(false)
-					return
-				}
+			req, err := http.NewRequestWithContext(ctx, "GET", reqUrl, nil)
+			if err != nil {
+				return
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				h.fail(fmt.Errorf("query hunter error: %v", err))
+				return
+			}
+
+			var result struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Data    struct {
+					Total int `json:"total"`
+					Arr   []struct {
+						IP       string `json:"ip"`
+						Port     int    `json:"port"`
+						Protocol string `json:"protocol"`
+					} `json:"arr"`
+					ConsumeQuota string `json:"consume_quota"` // 如 "消耗积分：50"
+					RestQuota    string `json:"rest_quota"`    // 如 "今日剩余积分：450"
+				} `json:"data"`
+			}
+
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 				resp.Body.Close()
+				h.fail(fmt.Errorf("query hunter error: %s: %v", resp.Status, err))
+				return
+			}
+			resp.Body.Close()
 
-				if result.Code != 200 {
-					h.SetAvailable(false)
-					return
-				}
+			switch {
+			case result.Code == 401 || result.Code == 403:
+				h.disable(fmt.Sprintf("authentication failed: %d %s", result.Code, result.Message))
+				return
+			case strings.Contains(result.Message, "积分"):
+				h.disable(fmt.Sprintf("quota exhausted: %d %s", result.Code, result.Message))
+				return
+			case result.Code != 200:
+				h.fail(fmt.Errorf("query hunter error: %d %s", result.Code, result.Message))
+				return
+			}
+			h.ReportSuccess()
 
-				for _, item := range result.Data.Arr {
-					select {
-					case <-ctx.Done():
-						return
-					case proxyChan <- fmt.Sprintf("socks5://%s:%d", item.IP, item.Port):
-						totalFetched++
-					}
-
-					if h.maxSize > 0 && totalFetched >= h.maxSize {
-						return
-					}
-				}
+			used := hunterQuota(result.Data.ConsumeQuota)
+			if used < 0 {
+				used = len(result.Data.Arr)
+			}
+			h.spend(credits, used, hunterQuota(result.Data.RestQuota))
 
-				if len(result.Data.Arr) < pageSize {
+			for _, item := range result.Data.Arr {
+				// 本页还有未取的结果时不推进翻页进度，下次从本页继续
+				if h.maxSize > 0 && totalFetched >= h.maxSize {
+					return
+				}
+				select {
+				case <-ctx.Done():
 					return
+				case proxyChan <- fmt.Sprintf("socks5://%s:%d", item.IP, item.Port):
+					totalFetched++
 				}
+			}
 
-				page++
-				time.Sleep(5 * time.Second)
+			// 本页已全部取完才推进翻页进度
+			last := len(result.Data.Arr) < h.pageSize || (result.Data.Total > 0 && page*h.pageSize >= result.Data.Total)
+			if last {
+				h.advance(credits, window, 1, "")
+			} else {
+				h.advance(credits, window, page+1, "")
+			}
+			if last || (h.maxSize > 0 && totalFetched >= h.maxSize) {
+				return
+			}
+			page++
+			if !waitPage(ctx, delay) {
+				return
 			}
 		}
 	}()
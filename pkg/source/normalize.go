@@ -0,0 +1,321 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// formatFields 格式模板支持的占位符，{ip} 与 {host} 等价，{*} 匹配任意内容
+var formatFields = map[string]string{
+	"scheme": `(?P<scheme>[A-Za-z][A-Za-z0-9+.-]*)`,
+	"ip":     `(?P<host>[^\s:@/,;|]+)`,
+	"host":   `(?P<host>[^\s:@/,;|]+)`,
+	"port":   `(?P<port>\d{1,5})`,
+	"user":   `(?P<user>[^\s:@,;|]*)`,
+	"pass":   `(?P<pass>[^\s@,;|]*)`,
+	"*":      `.*?`,
+}
+
+var (
+	placeholderRe = regexp.MustCompile(`\{(\w+|\*)\}`)
+	hostnameRe    = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+	whitespaceRe  = regexp.MustCompile(`\s+`)
+)
+
+// csvColumns CSV 表头中可以识别的列名
+var csvColumns = map[string]string{
+	"ip":         "host",
+	"host":       "host",
+	"address":    "host",
+	"ip_address": "host",
+	"server":     "host",
+	"port":       "port",
+	"user":       "user",
+	"username":   "user",
+	"login":      "user",
+	"pass":       "pass",
+	"password":   "pass",
+	"scheme":     "scheme",
+	"protocol":   "scheme",
+	"type":       "scheme",
+	"proxy":      "proxy",
+}
+
+// isFieldSeparator 自动识别时分隔列的字符：空白、逗号、分号与竖线
+func isFieldSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', ',', ';', '|':
+		return true
+	}
+	return false
+}
+
+// compileFormat 把 {ip}:{port}:{user}:{pass} 形式的模板编译为正则
+// 模板中的空白匹配任意空白，模板之后允许以分隔符开始的多余列(如国家、延迟)
+func compileFormat(format string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	seen := make(map[string]bool)
+	hasHost, hasPort := false, false
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(format, -1) {
+		b.WriteString(literalPattern(format[last:m[0]]))
+		name := strings.ToLower(format[m[2]:m[3]])
+		pattern, ok := formatFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder {%s}", name)
+		}
+		if name == "ip" {
+			name = "host"
+		}
+		if name != "*" && seen[name] {
+			return nil, fmt.Errorf("duplicate placeholder {%s}", name)
+		}
+		seen[name] = true
+		hasHost = hasHost || name == "host"
+		hasPort = hasPort || name == "port"
+		b.WriteString(pattern)
+		last = m[1]
+	}
+	b.WriteString(literalPattern(format[last:]))
+	b.WriteString(`(?:[\s,;|].*)?$`)
+	if !hasHost || !hasPort {
+		return nil, errors.New("must contain {ip} and {port}")
+	}
+	return regexp.Compile(b.String())
+}
+
+// literalPattern 转义模板中的普通字符，连续的空白匹配任意空白
+func literalPattern(s string) string {
+	parts := whitespaceRe.Split(s, -1)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, `\s+`)
+}
+
+// Normalizer 把各种格式的代理行转换为规范的代理 URL，并统计被拒绝的行
+// 未配置格式模板时自动识别 ip:port、ip:port:user:pass、user:pass@ip:port、ip port、带协议的 URL 与带表头的 CSV，
+// 行尾多余的列(如国家、延迟)会被忽略；CSV 表头只对之后的行有效，不能在多个 goroutine 中同时使用
+type Normalizer struct {
+	formats  []*regexp.Regexp
+	scheme   string
+	columns  map[string]int // CSV 表头中各字段的列号
+	sep      string         // CSV 的分隔符
+	rejected int
+}
+
+// NewNormalizer 创建代理行的规范化器，formats 为格式模板，scheme 为没有协议的行使用的协议，为空时默认 socks5
+// 代理池只支持 SOCKS5，协议不是 SOCKS5 的行会被拒绝
+func NewNormalizer(formats []string, scheme string) (*Normalizer, error) {
+	if scheme == "" {
+		scheme = "socks5"
+	}
+	if schemeFor(scheme) == "" {
+		return nil, fmt.Errorf("unsupported scheme %q, only socks5 is supported", scheme)
+	}
+	n := &Normalizer{scheme: scheme}
+	for _, f := range formats {
+		re, err := compileFormat(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format %q: %v", f, err)
+		}
+		n.formats = append(n.formats, re)
+	}
+	return n, nil
+}
+
+// Rejected 返回被拒绝的行数，空行、注释与 CSV 表头不计入
+func (n *Normalizer) Rejected() int {
+	return n.rejected
+}
+
+// resetHeader 清除已识别的 CSV 表头，开始读取另一个文件时调用
+func (n *Normalizer) resetHeader() {
+	n.columns, n.sep = nil, ""
+}
+
+// Normalize 返回一行对应的规范代理 URL，空行、注释、CSV 表头与无法识别的行返回 false
+func (n *Normalizer) Normalize(line string) (string, bool) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false
+	}
+
+	var (
+		proxy string
+		ok    bool
+	)
+	switch {
+	case len(n.formats) > 0:
+		proxy, ok = n.matchFormats(line)
+	case n.columns != nil:
+		proxy, ok = n.fromColumns(line)
+	default:
+		proxy, ok = n.detect(line)
+		if !ok && n.parseHeader(line) {
+			return "", false
+		}
+	}
+	if !ok {
+		n.rejected++
+		return "", false
+	}
+	return proxy, true
+}
+
+// matchFormats 按顺序匹配格式模板
+func (n *Normalizer) matchFormats(line string) (string, bool) {
+	for _, re := range n.formats {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		fields := make(map[string]string)
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				fields[name] = m[i]
+			}
+		}
+		if proxy, ok := n.build(fields["scheme"], fields["host"], fields["port"], fields["user"], fields["pass"]); ok {
+			return proxy, true
+		}
+	}
+	return "", false
+}
+
+// detect 自动识别常见的代理格式，只看第一列(ip port 格式看前两列)
+func (n *Normalizer) detect(line string) (string, bool) {
+	fields := strings.FieldsFunc(line, isFieldSeparator)
+	if len(fields) == 0 {
+		return "", false
+	}
+	first := fields[0]
+	switch {
+	case strings.Contains(first, "://"), strings.HasPrefix(first, "["), strings.Contains(first, "@"):
+		return n.fromURL(first)
+	}
+	// 密码中可能包含冒号
+	parts := strings.SplitN(first, ":", 4)
+	switch len(parts) {
+	case 1: // ip port
+		if len(fields) < 2 {
+			return "", false
+		}
+		return n.build("", parts[0], fields[1], "", "")
+	case 2: // ip:port
+		return n.build("", parts[0], parts[1], "", "")
+	case 4: // ip:port:user:pass
+		return n.build("", parts[0], parts[1], parts[2], parts[3])
+	}
+	return "", false
+}
+
+// fromURL 解析 URL 形式的代理，没有协议时使用默认协议
+func (n *Normalizer) fromURL(s string) (string, bool) {
+	if !strings.Contains(s, "://") {
+		s = n.scheme + "://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", false
+	}
+	var user, pass string
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	return n.build(u.Scheme, u.Hostname(), u.Port(), user, pass)
+}
+
+// parseHeader 识别 CSV 表头，至少包含 ip 与 port 两列或 proxy 一列时返回 true
+func (n *Normalizer) parseHeader(line string) bool {
+	sep := ""
+	for _, s := range []string{",", ";", "\t", "|"} {
+		if strings.Contains(line, s) {
+			sep = s
+			break
+		}
+	}
+	if sep == "" {
+		return false
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Split(line, sep) {
+		name = strings.ToLower(strings.Trim(strings.TrimSpace(name), `"'`))
+		if field, ok := csvColumns[name]; ok {
+			if _, dup := columns[field]; !dup {
+				columns[field] = i
+			}
+		}
+	}
+	_, hasHost := columns["host"]
+	_, hasPort := columns["port"]
+	_, hasProxy := columns["proxy"]
+	if !(hasHost && hasPort) && !hasProxy {
+		return false
+	}
+	n.columns, n.sep = columns, sep
+	return true
+}
+
+// fromColumns 按 CSV 表头取出各字段
+func (n *Normalizer) fromColumns(line string) (string, bool) {
+	cells := strings.Split(line, n.sep)
+	get := func(field string) string {
+		i, ok := n.columns[field]
+		if !ok || i >= len(cells) {
+			return ""
+		}
+		return strings.Trim(strings.TrimSpace(cells[i]), `"'`)
+	}
+	if _, ok := n.columns["host"]; !ok {
+		proxy := get("proxy")
+		if proxy == "" {
+			return "", false
+		}
+		if strings.Contains(proxy, "://") {
+			return n.fromURL(proxy)
+		}
+		return n.detect(proxy)
+	}
+	return n.build(get("scheme"), get("host"), get("port"), get("user"), get("pass"))
+}
+
+// fromFields 用已经分开的字段组装代理 URL，无法识别时计入被拒绝的条目
+func (n *Normalizer) fromFields(scheme, host, port, user, pass string) (string, bool) {
+	proxy, ok := n.build(scheme, host, port, user, pass)
+	if !ok {
+		n.rejected++
+	}
+	return proxy, ok
+}
+
+// build 校验各字段并组装为规范的代理 URL
+func (n *Normalizer) build(scheme, host, port, user, pass string) (string, bool) {
+	if scheme == "" {
+		scheme = n.scheme
+	}
+	scheme = schemeFor(scheme)
+	if scheme == "" {
+		return "", false
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if net.ParseIP(host) == nil && !hostnameRe.MatchString(host) {
+		return "", false
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return "", false
+	}
+	u := url.URL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(p))}
+	if user != "" || pass != "" {
+		u.User = url.UserPassword(user, pass)
+	}
+	return u.String(), true
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/projectdiscovery/gologger"
 	"io"
 	"net/http"
 	"time"
@@ -16,23 +15,33 @@ type QuakeSource struct {
 	apiKey   string
 	endpoint string
 	maxSize  int
+	pageSize int
+	days     int
 	query    string
 }
 
-func NewQuakeSource(apiKey, endpoint, query string, maxSize int, timeout int) *QuakeSource {
+func NewQuakeSource(apiKey, endpoint, query string, maxSize, pageSize, days int, timeout int) *QuakeSource {
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	if days <= 0 {
+		days = 7
+	}
 	return &QuakeSource{
 		BaseSource: NewBaseSource("Quake", timeout),
 		apiKey:     apiKey,
 		endpoint:   endpoint,
 		query:      query,
 		maxSize:    maxSize,
+		pageSize:   pageSize,
+		days:       days,
 	}
 }
 
 func (q *QuakeSource) Fetch(ctx context.Context) (<-chan string, error) {
 	proxyChan := make(chan string)
 
-	q.lastFetchTime = time.Now()
+	q.markFetched()
 
 	go func() {
 		defer func() {
@@ -40,100 +49,135 @@ func (q *QuakeSource) Fetch(ctx context.Context) (<-chan string, error) {
 			close(proxyChan)
 		}()
 
-		client := &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:    10,
-				IdleConnTimeout: 60 * time.Second,
-			},
-		}
+		client := newEngineClient()
+		credits, delay := q.budget(5 * time.Second)
 
-		start := 1
-		size := 10
+		size := q.pageSize
 		totalFetched := 0
-		startTime := time.Now().AddDate(0, 0, -7).Format("2006-01-02") // 7天前
+		startTime := time.Now().AddDate(0, 0, -q.days).Format("2006-01-02")
+
+		// 查询语句与时间窗口不变时从上次停止的页继续，避免重复获取排在前面的结果
+		window := q.query + "|" + startTime
+		page, _ := credits.Resume(window)
 
 		for {
-			select {
-			case <-ctx.Done():
+			// Quake 按返回的结果数扣除积分
+			if !q.allowPage(credits, size) {
 				return
-			default:
-				// 直接使用 q.endpoint（假设已包含完整路径）
-				reqUrl := q.endpoint
-				data := map[string]interface{}{
-					"query":        q.query,
-					"start":        start,
-					"size":         size,
-					"ignore_cache": true,
-					"start_time":   startTime,
-					"include": []string{
-						"ip", "port",
-					},
-					"latest": true,
-				}
-				body, _ := json.MarshalIndent(data, "", "  ")
-				gologger.Info().Msgf("fetching %v proxies from %v", size, q.endpoint)
-				req, err := http.NewRequestWithContext(ctx, "POST", reqUrl, bytes.NewBuffer(body))
-				if err != nil {
-					return
-				}
-				req.Header.Set("X-QuakeToken", q.apiKey)
-				req.Header.Set("Content-Type", "application/json")
+			}
 
-				resp, err := client.Do(req)
-				if err != nil {
-					return
-				}
-				respBody, _ := io.ReadAll(resp.Body)
-				//println(string(respBody))
-				// ...保持原有响应解析逻辑...
-				var result struct {
-					Code    interface{} `json:"code"`
-					Message string      `json:"message"`
-					Data    interface{} `json:"data"`
-				}
+			// 直接使用 q.endpoint（假设已包含完整路径）
+			reqUrl := q.endpoint
+			data := map[string]interface{}{
+				"query":        q.query,
+				"start":        1 + (page-1)*size,
+				"size":         size,
+				"ignore_cache": true,
+				"start_time":   startTime,
+				"include": []string{
+					"ip", "port",
+				},
+				"latest": true,
+			}
+			body, _ := json.MarshalIndent(data, "", "  ")
+			q.Logger().Infof("fetching page %d (%d per page) from %v", page, size, q.endpoint)
+			req, err := http.NewRequestWithContext(ctx, "POST", reqUrl, bytes.NewBuffer(body))
+			if err != nil {
+				return
+			}
+			req.Header.Set("X-QuakeToken", q.apiKey)
+			req.Header.Set("Content-Type", "application/json")
 
-				if err := json.NewDecoder(bytes.NewBuffer(respBody)).Decode(&result); err != nil {
-					resp.Body.Close()
-					//q.SetAvailable(false)
-					return
-				}
-				resp.Body.Close()
+			resp, err := client.Do(req)
+			if err != nil {
+				q.fail(fmt.Errorf("query quake error: %v", err))
+				return
+			}
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			var result struct {
+				Code    interface{} `json:"code"`
+				Message string      `json:"message"`
+				Data    interface{} `json:"data"`
+				Meta    struct {
+					Pagination struct {
+						Total int `json:"total"`
+					} `json:"pagination"`
+				} `json:"meta"`
+			}
 
-				_, ok := result.Code.(string)
-				if ok {
-					gologger.Warning().Msgf("query quake error: %v", result.Message)
-					//q.SetAvailable(false)
-					return
-				}
-				resultData, ok := result.Data.([]interface{})
-				if !ok {
-					return
-				}
+			if err := json.NewDecoder(bytes.NewBuffer(respBody)).Decode(&result); err != nil {
+				q.fail(fmt.Errorf("query quake error: %s: %v", resp.Status, err))
+				return
+			}
 
-				for _, item := range resultData {
-					resultData_, _ := item.(map[string]interface{})
-					select {
-					case <-ctx.Done():
-						return
-					case proxyChan <- fmt.Sprintf("socks5://%s:%v", resultData_["ip"], resultData_["port"]):
-						totalFetched++
-					}
-
-					if q.maxSize > 0 && totalFetched >= q.maxSize {
-						return
-					}
-				}
+			// 出错时 code 为字符串，如 "u3004"
+			if code, ok := result.Code.(string); ok {
+				q.fail(fmt.Errorf("query quake error: %s %v", code, result.Message))
+				return
+			}
+			resultData, ok := result.Data.([]interface{})
+			if !ok {
+				q.fail(fmt.Errorf("query quake error: unexpected data %T", result.Data))
+				return
+			}
+			q.ReportSuccess()
+
+			// 搜索接口的响应不包含剩余积分，从用户信息接口获取
+			q.spend(credits, len(resultData), q.remaining(ctx, client))
 
-				if len(resultData) < size {
+			for _, item := range resultData {
+				// 本页还有未取的结果时不推进翻页进度，下次从本页继续
+				if q.maxSize > 0 && totalFetched >= q.maxSize {
+					return
+				}
+				resultData_, _ := item.(map[string]interface{})
+				select {
+				case <-ctx.Done():
 					return
+				case proxyChan <- fmt.Sprintf("socks5://%s:%v", resultData_["ip"], resultData_["port"]):
+					totalFetched++
 				}
+			}
 
-				start = start + size
-				time.Sleep(5 * time.Second)
+			// 本页已全部取完才推进翻页进度
+			last := len(resultData) < size || (result.Meta.Pagination.Total > 0 && page*size >= result.Meta.Pagination.Total)
+			if last {
+				q.advance(credits, window, 1, "")
+			} else {
+				q.advance(credits, window, page+1, "")
+			}
+			if last || (q.maxSize > 0 && totalFetched >= q.maxSize) {
+				return
+			}
+			page++
+			if !waitPage(ctx, delay) {
+				return
 			}
 		}
 	}()
 
 	return proxyChan, nil
 }
+
+// remaining 查询账户剩余的月度积分与长效积分之和，查询失败时返回 -1
+func (q *QuakeSource) remaining(ctx context.Context, client *http.Client) int {
+	var info struct {
+		Code interface{} `json:"code"`
+		Data struct {
+			Credit           *int `json:"credit"`
+			PersistentCredit int  `json:"persistent_credit"`
+		} `json:"data"`
+	}
+	header := http.Header{}
+	header.Set("X-QuakeToken", q.apiKey)
+	if err := accountInfo(ctx, client, q.endpoint, "../user/info", nil, header, &info); err != nil || info.Data.Credit == nil {
+		return -1
+	}
+	// 出错时 code 为字符串
+	if _, ok := info.Code.(string); ok {
+		return -1
+	}
+	return *info.Data.Credit + info.Data.PersistentCredit
+}
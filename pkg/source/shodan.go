@@ -0,0 +1,157 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shodanPageSize Shodan 每页固定返回 100 条结果
+const shodanPageSize = 100
+
+type ShodanSource struct {
+	*BaseSource
+	key      string
+	endpoint string
+	query    string
+	maxSize  int
+}
+
+func NewShodanSource(key, endpoint, query string, maxSize int, timeout int) *ShodanSource {
+	return &ShodanSource{
+		BaseSource: NewBaseSource("shodan", timeout),
+		key:        key,
+		endpoint:   endpoint,
+		query:      query,
+		maxSize:    maxSize,
+	}
+}
+
+// shodanResponse Shodan /shodan/host/search 的响应
+type shodanResponse struct {
+	Error   string `json:"error"`
+	Total   int    `json:"total"`
+	Matches []struct {
+		IPStr   string `json:"ip_str"`
+		Port    int    `json:"port"`
+		Product string `json:"product"`
+		Shodan  struct {
+			Module string `json:"module"`
+		} `json:"_shodan"`
+	} `json:"matches"`
+}
+
+func (s *ShodanSource) Fetch(ctx context.Context) (<-chan string, error) {
+	proxyChan := make(chan string)
+
+	s.markFetched()
+
+	go func() {
+		defer close(proxyChan)
+
+		client := newEngineClient()
+		credits, delay := s.budget(time.Second)
+		window := s.query
+		page, _ := credits.Resume(window)
+		totalFetched := 0
+		for {
+			// Shodan 每次带过滤条件或翻页的查询扣除 1 个 query credit
+			if !s.allowPage(credits, 1) {
+				return
+			}
+
+			params := url.Values{}
+			params.Set("key", s.key)
+			params.Set("query", s.query)
+			params.Set("page", strconv.Itoa(page))
+
+			s.Logger().Infof("fetching page %d from %s", page, s.endpoint)
+			req, err := http.NewRequestWithContext(ctx, "GET", s.endpoint+"?"+params.Encode(), nil)
+			if err != nil {
+				return
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				s.fail(fmt.Errorf("query shodan error: %v", err))
+				return
+			}
+			var result shodanResponse
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+				s.disable(fmt.Sprintf("authentication failed: %s %s", resp.Status, result.Error))
+				return
+			case resp.StatusCode == http.StatusPaymentRequired, strings.Contains(strings.ToLower(result.Error), "credits"):
+				s.disable(fmt.Sprintf("quota exhausted: %s %s", resp.Status, result.Error))
+				return
+			case err != nil:
+				s.fail(fmt.Errorf("query shodan error: %s: %v", resp.Status, err))
+				return
+			case result.Error != "" || resp.StatusCode != http.StatusOK:
+				s.fail(fmt.Errorf("query shodan error: %s %s", resp.Status, result.Error))
+				return
+			}
+			s.ReportSuccess()
+			s.spend(credits, 1, s.remaining(ctx, client))
+
+			for _, match := range result.Matches {
+				// 本页还有未取的结果时不推进翻页进度，下次从本页继续
+				if s.maxSize > 0 && totalFetched >= s.maxSize {
+					return
+				}
+				// 按扫描模块识别协议，模块缺失时参考产品名称
+				protocol := match.Shodan.Module
+				if protocol == "" {
+					protocol = match.Product
+				}
+				scheme := schemeFor(protocol)
+				if scheme == "" || match.IPStr == "" {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case proxyChan <- fmt.Sprintf("%s://%s:%d", scheme, match.IPStr, match.Port):
+					totalFetched++
+				}
+			}
+
+			// 本页已全部取完才推进翻页进度
+			last := len(result.Matches) < shodanPageSize || page*shodanPageSize >= result.Total
+			if last {
+				s.advance(credits, window, 1, "")
+			} else {
+				s.advance(credits, window, page+1, "")
+			}
+			if last || (s.maxSize > 0 && totalFetched >= s.maxSize) {
+				return
+			}
+			page++
+			if !waitPage(ctx, delay) {
+				return
+			}
+		}
+	}()
+
+	return proxyChan, nil
+}
+
+// remaining 查询账户剩余的 query credits，查询失败时返回 -1
+func (s *ShodanSource) remaining(ctx context.Context, client *http.Client) int {
+	var info struct {
+		QueryCredits *int `json:"query_credits"`
+	}
+	params := url.Values{}
+	params.Set("key", s.key)
+	if err := accountInfo(ctx, client, s.endpoint, "/api-info", params, nil, &info); err != nil || info.QueryCredits == nil {
+		return -1
+	}
+	return *info.QueryCredits
+}
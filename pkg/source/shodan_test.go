@@ -0,0 +1,89 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShodanFetch(t *testing.T) {
+	data := readFixture(t, "shodan_search.json")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shodan/host/search", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("key") != "key" || q.Get("query") != "socks5" || q.Get("page") != "1" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		_, _ = w.Write(data)
+	})
+	mux.HandleFunc("/api-info", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "key" {
+			t.Errorf("unexpected account info query: %s", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"scan_credits": 100, "plan": "dev", "query_credits": 99, "monitored_ips": 16}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	store, _ := NewCreditStore("")
+	credits := store.Credits("shodan", 0, 0)
+	s := NewShodanSource("key", srv.URL+"/shodan/host/search", "socks5", 0, 10)
+	s.SetBudget(credits, time.Millisecond)
+	ch, err := s.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// http 代理被忽略，模块缺失时按产品名称识别
+	want := []string{"socks5://203.0.113.10:1080", "socks5://203.0.113.12:9050"}
+	if got := collect(t, ch); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxies = %v, want %v", got, want)
+	}
+	if h := s.Status().Health; h != HealthHealthy {
+		t.Errorf("health = %s, want healthy", h)
+	}
+	if st := credits.State(); st.UsedDay != 1 || st.Remaining != 99 {
+		t.Errorf("used = %d, remaining = %d, want 1 and 99", st.UsedDay, st.Remaining)
+	}
+}
+
+func TestShodanErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		reason string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error": "Invalid API key"}`, "authentication failed"},
+		{"forbidden", http.StatusForbidden, `{"error": "Access denied"}`, "authentication failed"},
+		{"payment required", http.StatusPaymentRequired, `{"error": "Requires membership or higher to access"}`, "quota exhausted"},
+		{"no credits", http.StatusOK, `{"error": "Insufficient query credits, please upgrade your API plan or wait for the monthly limit to reset"}`, "quota exhausted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			s := NewShodanSource("key", srv.URL, "socks5", 0, 10)
+			ch, err := s.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collect(t, ch); len(got) != 0 {
+				t.Errorf("proxies = %v, want none", got)
+			}
+			if h := s.Status().Health; h != HealthFailing {
+				t.Errorf("health = %s, want failing", h)
+			}
+			if reason := s.UnavailableReason(); !strings.HasPrefix(reason, tt.reason) {
+				t.Errorf("reason = %q, want prefix %q", reason, tt.reason)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package source
 
 import (
 	"context"
+	"errors"
+	"github.com/wjlin0/deadpool/pkg/types"
 	"sync"
 	"time"
 )
@@ -14,31 +16,58 @@ type Source interface {
 	// Fetch 从源获取代理列表
 	Fetch(ctx context.Context) (<-chan string, error)
 
-	// IsAvailable 检查源是否可用
+	// IsAvailable 检查源是否可用，失败后的退避期间不可用
 	IsAvailable() bool
+
+	// Status 返回源的健康状态
+	Status() Status
 	QueryTimeout() int
 	ValidateLastFetchTime() bool
+
+	// LastFetchTime 返回最近一次获取的时间，从未获取时为零值
+	LastFetchTime() time.Time
+
+	// SetLogger 设置源使用的日志实现
+	SetLogger(logger types.Logger)
 }
 
 // BaseSource 提供基础实现
 type BaseSource struct {
 	name          string
-	available     bool
+	status        Status
 	timeout       int
 	lastFetchTime time.Time
+	logger        types.Logger
+	credits       *Credits      // 积分预算与翻页进度，搜索引擎数据源使用
+	pageDelay     time.Duration // 翻页间隔，0 表示使用数据源的默认值
 	mu            sync.RWMutex
 }
 
 func (b *BaseSource) ValidateLastFetchTime() bool {
-	return time.Since(b.lastFetchTime) > time.Duration(b.timeout)*time.Minute
+	return time.Since(b.LastFetchTime()) > time.Duration(b.timeout)*time.Minute
+}
+
+// LastFetchTime 返回最近一次获取的时间(线程安全)
+func (b *BaseSource) LastFetchTime() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lastFetchTime
+}
+
+// markFetched 记录本次获取的时间(线程安全)
+func (b *BaseSource) markFetched() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastFetchTime = time.Now()
 }
 
 // NewBaseSource 创建基础源
 func NewBaseSource(name string, timeout int) *BaseSource {
 	return &BaseSource{
-		name:      name,
-		timeout:   timeout,
-		available: true, // 默认可用
+		name:    name,
+		timeout: timeout,
+		status:  Status{Health: HealthHealthy}, // 默认可用
+		logger:  types.DefaultLogger(),
 	}
 }
 
@@ -50,15 +79,54 @@ func (b *BaseSource) QueryTimeout() int {
 	return b.timeout
 }
 
+// IsAvailable 检查源是否可用，失败后在退避结束前不可用(线程安全)
 func (b *BaseSource) IsAvailable() bool {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	return b.available
+	return !time.Now().Before(b.status.NextRetry)
 }
 
-// SetAvailable 设置源可用状态(线程安全)
+// SetAvailable 设置源可用状态(线程安全)，true 记为一次成功，false 记为一次失败
 func (b *BaseSource) SetAvailable(available bool) {
+	if available {
+		b.ReportSuccess()
+		return
+	}
+	b.ReportFailure(errors.New("marked unavailable"))
+}
+
+// SetUnavailable 标记源不可用并记录原因(线程安全)，用于重试意义不大的错误，直接进入 failing 并使用最长的退避时间
+func (b *BaseSource) SetUnavailable(reason string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.available = available
+	now := time.Now()
+	b.status.Health = HealthFailing
+	b.status.ConsecutiveFailures++
+	b.status.LastError = reason
+	b.status.LastErrorTime = now
+	b.status.NextRetry = now.Add(retryMaxDelay)
+}
+
+// UnavailableReason 返回源不可用的原因，healthy 时为空
+func (b *BaseSource) UnavailableReason() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.status.Health == HealthHealthy {
+		return ""
+	}
+	return b.status.LastError
+}
+
+// SetLogger 设置日志实现(线程安全)
+func (b *BaseSource) SetLogger(logger types.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logger = logger
+}
+
+// Logger 返回当前的日志实现
+func (b *BaseSource) Logger() types.Logger {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.logger
 }
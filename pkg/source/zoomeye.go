@@ -0,0 +1,147 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// zoomEyeSuccess ZoomEye v2 接口成功时的业务码
+const zoomEyeSuccess = 60000
+
+type ZoomEyeSource struct {
+	*BaseSource
+	apiKey   string
+	endpoint string
+	query    string
+	pageSize int
+	maxSize  int
+}
+
+func NewZoomEyeSource(apiKey, endpoint, query string, pageSize, maxSize int, timeout int) *ZoomEyeSource {
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	return &ZoomEyeSource{
+		BaseSource: NewBaseSource("zoomeye", timeout),
+		apiKey:     apiKey,
+		endpoint:   endpoint,
+		query:      query,
+		pageSize:   pageSize,
+		maxSize:    maxSize,
+	}
+}
+
+// zoomEyeResponse ZoomEye /v2/search 的响应
+type zoomEyeResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Total   int    `json:"total"`
+	Data    []struct {
+		IP      string `json:"ip"`
+		Port    int    `json:"port"`
+		Service string `json:"service"`
+	} `json:"data"`
+}
+
+func (z *ZoomEyeSource) Fetch(ctx context.Context) (<-chan string, error) {
+	proxyChan := make(chan string)
+
+	z.markFetched()
+
+	go func() {
+		defer close(proxyChan)
+
+		client := newEngineClient()
+		qbase64 := base64.StdEncoding.EncodeToString([]byte(z.query))
+		credits, delay := z.budget(time.Second)
+		window := z.query
+		page, _ := credits.Resume(window)
+		totalFetched := 0
+		for {
+			// ZoomEye 按返回的结果数扣除积分
+			if !z.allowPage(credits, z.pageSize) {
+				return
+			}
+
+			body, _ := json.Marshal(map[string]interface{}{
+				"qbase64":  qbase64,
+				"page":     page,
+				"pagesize": z.pageSize,
+				"fields":   "ip,port,service",
+			})
+			z.Logger().Infof("fetching page %d (%d per page) from %s", page, z.pageSize, z.endpoint)
+			req, err := http.NewRequestWithContext(ctx, "POST", z.endpoint, bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			req.Header.Set("API-KEY", z.apiKey)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				z.fail(fmt.Errorf("query zoomeye error: %v", err))
+				return
+			}
+			var result zoomEyeResponse
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+
+			message := strings.ToLower(result.Message)
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized, strings.Contains(message, "api key"), strings.Contains(message, "login"):
+				z.disable(fmt.Sprintf("authentication failed: %s %s", resp.Status, result.Message))
+				return
+			case resp.StatusCode == http.StatusPaymentRequired, strings.Contains(message, "credit"):
+				z.disable(fmt.Sprintf("quota exhausted: %s %s", resp.Status, result.Message))
+				return
+			case err != nil:
+				z.fail(fmt.Errorf("query zoomeye error: %s: %v", resp.Status, err))
+				return
+			case result.Code != zoomEyeSuccess:
+				z.fail(fmt.Errorf("query zoomeye error: %d %s", result.Code, result.Message))
+				return
+			}
+			z.ReportSuccess()
+			z.spend(credits, len(result.Data), -1)
+
+			for _, item := range result.Data {
+				// 本页还有未取的结果时不推进翻页进度，下次从本页继续
+				if z.maxSize > 0 && totalFetched >= z.maxSize {
+					return
+				}
+				scheme := schemeFor(item.Service)
+				if scheme == "" || item.IP == "" {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case proxyChan <- fmt.Sprintf("%s://%s:%d", scheme, item.IP, item.Port):
+					totalFetched++
+				}
+			}
+
+			// 本页已全部取完才推进翻页进度
+			last := len(result.Data) < z.pageSize || page*z.pageSize >= result.Total
+			if last {
+				z.advance(credits, window, 1, "")
+			} else {
+				z.advance(credits, window, page+1, "")
+			}
+			if last || (z.maxSize > 0 && totalFetched >= z.maxSize) {
+				return
+			}
+			page++
+			if !waitPage(ctx, delay) {
+				return
+			}
+		}
+	}()
+
+	return proxyChan, nil
+}
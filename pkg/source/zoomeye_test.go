@@ -0,0 +1,99 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestZoomEyeFetch(t *testing.T) {
+	pages := map[int][]byte{
+		1: readFixture(t, "zoomeye_search_page1.json"),
+		2: readFixture(t, "zoomeye_search_page2.json"),
+	}
+	var (
+		mu        sync.Mutex
+		requested []int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("API-KEY") != "key" {
+			t.Errorf("unexpected request: %s API-KEY=%q", r.Method, r.Header.Get("API-KEY"))
+		}
+		var body struct {
+			Qbase64  string `json:"qbase64"`
+			Page     int    `json:"page"`
+			PageSize int    `json:"pagesize"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if query, _ := base64.StdEncoding.DecodeString(body.Qbase64); string(query) != `service="socks5"` || body.PageSize != 2 {
+			t.Errorf("unexpected request body: %+v", body)
+		}
+		mu.Lock()
+		requested = append(requested, body.Page)
+		mu.Unlock()
+		_, _ = w.Write(pages[body.Page])
+	}))
+	defer srv.Close()
+
+	z := NewZoomEyeSource("key", srv.URL, `service="socks5"`, 2, 0, 10)
+	z.SetBudget(nil, time.Millisecond)
+	ch, err := z.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"socks5://198.51.100.20:1080", "socks5://198.51.100.22:7890"}
+	if got := collect(t, ch); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxies = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(requested, []int{1, 2}) {
+		t.Errorf("pages = %v, want [1 2]", requested)
+	}
+}
+
+func TestZoomEyeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		health Health
+		reason string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"code": 60001, "message": "Invalid API key"}`, HealthFailing, "authentication failed"},
+		{"no credits", http.StatusPaymentRequired, `{"code": 60003, "message": "Insufficient credits"}`, HealthFailing, "quota exhausted"},
+		{"other", http.StatusOK, `{"code": 60009, "message": "Query syntax error"}`, HealthDegraded, "query zoomeye error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			z := NewZoomEyeSource("key", srv.URL, `service="socks5"`, 2, 0, 10)
+			ch, err := z.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collect(t, ch); len(got) != 0 {
+				t.Errorf("proxies = %v, want none", got)
+			}
+			st := z.Status()
+			if st.Health != tt.health {
+				t.Errorf("health = %s, want %s", st.Health, tt.health)
+			}
+			if !strings.HasPrefix(st.LastError, tt.reason) {
+				t.Errorf("last error = %q, want prefix %q", st.LastError, tt.reason)
+			}
+		})
+	}
+}
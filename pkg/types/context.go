@@ -0,0 +1,47 @@
+package types
+
+import (
+	"context"
+	"net"
+)
+
+// DialInfo 实时拨号时选中的上游信息，由拨号方(代理管理器)填写，供访问日志等使用
+type DialInfo struct {
+	Upstream string // 上游代理 ip:port
+	ExitIP   string // 上游的出口IP
+}
+
+type dialInfoKey struct{}
+
+// WithDialInfo 返回携带 DialInfo 的 ctx，拨号方会把选中的上游写入 info
+func WithDialInfo(ctx context.Context, info *DialInfo) context.Context {
+	return context.WithValue(ctx, dialInfoKey{}, info)
+}
+
+// DialInfoFromContext 返回 ctx 中的 DialInfo，不存在时返回 nil
+func DialInfoFromContext(ctx context.Context) *DialInfo {
+	info, _ := ctx.Value(dialInfoKey{}).(*DialInfo)
+	return info
+}
+
+// Request 客户端请求的信息，由监听服务填写，供路由等使用
+type Request struct {
+	User string // 认证用户，未认证时为空
+	FQDN string // 客户端请求的域名，请求 IP 时为空
+	IP   net.IP // 监听在本地解析域名得到的 IP，未在本地解析时为 nil
+	// CheckDirect 直连前按目标地址规则检查实际连接的 IP，域名不在本地解析时监听只能按域名检查，nil 表示不检查
+	CheckDirect func(ip net.IP) error
+}
+
+type requestKey struct{}
+
+// WithRequest 返回携带 Request 的 ctx
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFromContext 返回 ctx 中的 Request，不存在时返回 nil
+func RequestFromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
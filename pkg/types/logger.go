@@ -0,0 +1,46 @@
+package types
+
+import "github.com/projectdiscovery/gologger"
+
+// Logger 日志接口，嵌入到其他程序时可以替换为自己的实现
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// DefaultLogger 返回基于 gologger 的默认日志实现
+func DefaultLogger() Logger {
+	return gologgerLogger{}
+}
+
+// NopLogger 返回丢弃所有日志的实现
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type gologgerLogger struct{}
+
+func (gologgerLogger) Debugf(format string, args ...interface{}) {
+	gologger.Debug().Msgf(format, args...)
+}
+
+func (gologgerLogger) Infof(format string, args ...interface{}) {
+	gologger.Info().Msgf(format, args...)
+}
+
+func (gologgerLogger) Warningf(format string, args ...interface{}) {
+	gologger.Warning().Msgf(format, args...)
+}
+
+func (gologgerLogger) Errorf(format string, args ...interface{}) {
+	gologger.Error().Msgf(format, args...)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{})   {}
+func (nopLogger) Infof(string, ...interface{})    {}
+func (nopLogger) Warningf(string, ...interface{}) {}
+func (nopLogger) Errorf(string, ...interface{})   {}
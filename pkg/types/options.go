@@ -3,24 +3,91 @@ package types
 type Options struct {
 	ConfigPath         string
 	AliveDataPath      string
+	QuotaDataPath      string
+	CreditDataPath     string
 	Debug              bool
 	DisableUpdateCheck bool
 }
 
 type ConfigOptions struct {
-	Options        *Options        `yaml:"-"`
-	Listener       *Listener       `yaml:"listener"`
-	CheckSock      *CheckSock      `yaml:"checkSock"`
-	CheckGeolocate *CheckGeolocate `yaml:"checkGeolocate"`
-	SourcesConfig  *SourcesConfig  `yaml:"sourcesConfig"`
+	Options        *Options         `yaml:"-"`
+	Listener       *Listener        `yaml:"listener"`
+	CheckSock      *CheckSock       `yaml:"checkSock"`
+	CheckGeolocate *CheckGeolocate  `yaml:"checkGeolocate"`
+	SourcesConfig  *SourcesConfig   `yaml:"sourcesConfig"`
+	Admin          *Admin           `yaml:"admin"`
+	AccessLog      *AccessLog       `yaml:"accessLog"`
+	Pools          map[string]*Pool `yaml:"pools"`
+	Routing        *Routing         `yaml:"routing"`
+}
+
+// Pool 命名代理池，按来源与出口国家从代理池中筛选代理，条件为空表示不限制
+type Pool struct {
+	Sources    []string `yaml:"sources"`    // 代理来源，如 hunter、file
+	Countries  []string `yaml:"countries"`  // 出口所在国家，来自地理位置检测，忽略大小写
+	MaxLatency int      `yaml:"maxLatency"` // 该代理池可接受的最大延迟(毫秒)，0 表示只使用 checkSock.maxLatency
+	DNS        *DNS     `yaml:"dns"`        // 路由到该代理池的请求的域名解析方式，未配置时与监听相同
+}
+
+// DNS 目标域名的解析方式
+type DNS struct {
+	Mode    string   `yaml:"mode"`    // remote: 交给上游代理解析；local: 本地解析；proxy: 经选中的代理查询 DNS 服务器
+	Servers []string `yaml:"servers"` // DNS 服务器，支持 udp://、tcp://、tls://(DoT) 与 https://(DoH)，local 模式留空时使用系统的解析器
+	Timeout int      `yaml:"timeout"` // 单次查询的超时(秒)
+}
+
+// Routing 按目标选择出口的规则
+type Routing struct {
+	Rules []string `yaml:"rules"` // TYPE,PAYLOAD,TARGET，按顺序匹配，第一条匹配的规则生效，都不匹配时使用整个代理池
+	GeoIP string   `yaml:"geoip"` // GEOIP 规则使用的 MaxMind 国家数据库(mmdb)路径
+}
+
+// AccessLog 访问日志配置，每个客户端连接关闭时写入一条
+type AccessLog struct {
+	Enabled    bool   `yaml:"enabled"`
+	Path       string `yaml:"path"`
+	Format     string `yaml:"format"`     // json 或 text
+	MaxSize    int    `yaml:"maxSize"`    // 单个文件的最大大小(MB)，超过后轮转
+	MaxBackups int    `yaml:"maxBackups"` // 保留的轮转文件数
+}
+
+// Admin 管理 API 配置，使用独立的监听地址，所有请求都需要携带 token
+type Admin struct {
+	Enabled bool   `yaml:"enabled"`
+	IP      string `yaml:"ip"`
+	Port    int    `yaml:"port"`
+	Token   string `yaml:"token"` // 访问令牌，通过 Authorization: Bearer <token> 传递
 }
 
 type SourcesConfig struct {
-	Hunter       *HunterSource `yaml:"hunter"`
-	Quake        *QuakeSource  `yaml:"quake"`
-	File         *FileSource   `yaml:"file"`
-	CheckerProxy *CheckerProxy `yaml:"checkerProxy"`
-	Customs      []*Custom     `yaml:"customs"`
+	Hunter       *HunterSource  `yaml:"hunter"`
+	Quake        *QuakeSource   `yaml:"quake"`
+	Fofa         *FofaSource    `yaml:"fofa"`
+	Shodan       *ShodanSource  `yaml:"shodan"`
+	ZoomEye      *ZoomEyeSource `yaml:"zoomeye"`
+	Censys       *CensysSource  `yaml:"censys"`
+	File         *FileSource    `yaml:"file"`
+	CheckerProxy *CheckerProxy  `yaml:"checkerProxy"`
+	Customs      []*Custom      `yaml:"customs"`
+}
+
+// Scheduling 代理池不足时选择数据源的顺序：先按 priority 从小到大，同一优先级内按每个入池代理的预计成本从低到高
+type Scheduling struct {
+	Priority int  `yaml:"priority" json:"priority"` // 优先级，越小越先获取
+	Cost     *int `yaml:"cost" json:"cost"`         // 每次获取的相对成本，未配置时搜索引擎为 1、免费数据源为 0，可以显式配置为 0
+}
+
+// LineFormat 文本代理列表每行的格式，formats 为空时自动识别常见格式
+type LineFormat struct {
+	Formats []string `yaml:"formats"` // 格式模板，如 {ip}:{port}:{user}:{pass}，按顺序匹配，行尾多余的列会被忽略
+	Scheme  string   `yaml:"scheme"`  // 没有协议的行使用的协议，默认 socks5
+}
+
+// Budget 搜索引擎数据源的积分预算与翻页间隔，积分用量与翻页进度保存在 -credit-data-path 文件中
+type Budget struct {
+	DailyBudget   int `yaml:"dailyBudget"`   // 每天最多消耗的积分，0 表示不限制
+	MonthlyBudget int `yaml:"monthlyBudget"` // 每月最多消耗的积分，0 表示不限制
+	PageDelay     int `yaml:"pageDelay"`     // 翻页间隔(秒)，0 表示使用数据源的默认值
 }
 
 type HunterSource struct {
@@ -29,9 +96,13 @@ type HunterSource struct {
 	Endpoint      string `yaml:"endpoint"`
 	Query         string `yaml:"query"`
 	MaxSize       int    `yaml:"maxSize"`
+	PageSize      int    `yaml:"pageSize"`      // 每页的结果数，最大 100
+	Days          int    `yaml:"days"`          // 只查询最近几天的资产
 	CheckInterval int    `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	Budget        `yaml:",inline"`
 
-	QueryTimeout int `yaml:"queryTimeout"` // 请求延迟时间
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
 }
 
 type QuakeSource struct {
@@ -40,24 +111,94 @@ type QuakeSource struct {
 	Endpoint      string `yaml:"endpoint"`
 	MaxSize       int    `yaml:"maxSize"`
 	Query         string `yaml:"query"`
+	PageSize      int    `yaml:"pageSize"`      // 每页的结果数
+	Days          int    `yaml:"days"`          // 只查询最近几天的资产
 	CheckInterval int    `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	Budget        `yaml:",inline"`
 
-	QueryTimeout int `yaml:"queryTimeout"` // 请求延迟时间
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
 }
 
-type FileSource struct {
+type FofaSource struct {
+	Enabled       bool     `yaml:"enabled"`
+	Email         string   `yaml:"email"` // 旧版接口需要，新版接口只需要 key
+	Key           string   `yaml:"key"`
+	Endpoint      string   `yaml:"endpoint"`
+	Query         string   `yaml:"query"`
+	MaxSize       int      `yaml:"maxSize"`
+	PageSize      int      `yaml:"pageSize"`      // 每页的结果数
+	Fields        []string `yaml:"fields"`        // 返回的字段，可选 ip、port、protocol，必须包含 ip 与 port
+	Days          int      `yaml:"days"`          // 只查询最近几天更新的资产，0 表示不限制
+	CheckInterval int      `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	Budget        `yaml:",inline"`
+
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
+}
+
+type ShodanSource struct {
 	Enabled       bool   `yaml:"enabled"`
-	Path          string `yaml:"path"`
+	Key           string `yaml:"key"`
+	Endpoint      string `yaml:"endpoint"`
+	Query         string `yaml:"query"`
+	MaxSize       int    `yaml:"maxSize"`       // Shodan 每页固定返回 100 条结果
 	CheckInterval int    `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	Budget        `yaml:",inline"`
 
-	QueryTimeout int `yaml:"queryTimeout"` // 请求延迟时间
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
+}
+
+type ZoomEyeSource struct {
+	Enabled       bool   `yaml:"enabled"`
+	APIKey        string `yaml:"apiKey"`
+	Endpoint      string `yaml:"endpoint"`
+	Query         string `yaml:"query"`
+	PageSize      int    `yaml:"pageSize"` // 每页的结果数
+	MaxSize       int    `yaml:"maxSize"`
+	CheckInterval int    `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	Budget        `yaml:",inline"`
+
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
+}
+
+type CensysSource struct {
+	Enabled       bool   `yaml:"enabled"`
+	APIID         string `yaml:"apiID"`
+	APISecret     string `yaml:"apiSecret"`
+	Endpoint      string `yaml:"endpoint"`
+	Query         string `yaml:"query"`
+	PageSize      int    `yaml:"pageSize"` // 每页的主机数，最大 100
+	MaxSize       int    `yaml:"maxSize"`
+	CheckInterval int    `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	Budget        `yaml:",inline"`
+
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
+}
+
+type FileSource struct {
+	Enabled       bool     `yaml:"enabled"`
+	Path          string   `yaml:"path"`
+	Paths         []string `yaml:"paths"`         // 更多的文件、目录或通配符(如 lists/*.txt.gz)，与 path 合并读取
+	Watch         bool     `yaml:"watch"`         // 监听文件变化，变化后立即读取新增的代理
+	Prune         bool     `yaml:"prune"`         // 监听到变化时删除代理池中已从文件里移除的代理
+	CheckInterval int      `yaml:"checkInterval"` // 检测间隔(分钟)
+	Scheduling    `yaml:",inline"`
+	LineFormat    `yaml:",inline"`
+
+	QueryTimeout int `yaml:"queryTimeout"` // 获取间隔(分钟)
 }
 
 type CheckerProxy struct {
 	Enabled       bool   `yaml:"enabled"`
 	Endpoint      string `yaml:"endpoint"`
 	CheckInterval int    `yaml:"checkInterval"` // 检测间隔(分钟)
-	QueryTimeout  int    `yaml:"queryTimeout"`  // 请求延迟时间
+	QueryTimeout  int    `yaml:"queryTimeout"`  // 获取间隔(分钟)
+
+	Scheduling `yaml:",inline"`
 }
 
 type Custom struct {
@@ -70,27 +211,90 @@ type Custom struct {
 	ResponseType  string              `yaml:"type"`
 	EnablePaging  bool                `yaml:"enablePaging"`
 	CheckInterval int                 `yaml:"checkInterval"` // 检测间隔(分钟)
-	QueryTimeout  int                 `yaml:"queryTimeout"`  // 请求延迟时间
+	QueryTimeout  int                 `yaml:"queryTimeout"`  // 获取间隔(分钟)
+
+	Scheduling `yaml:",inline"`
+	LineFormat `yaml:",inline"` // type 为 text 时每行的格式
 }
 type ProxyExtractConfig struct {
-	ProxyListPath string `yaml:"path"`      // 代理列表的 JSON/XPATH 路径，如 "data.proxies"
-	IPField       string `yaml:"ipField"`   // IP 字段名，如 "ip"
-	PortField     string `yaml:"portField"` // Port 字段名，如 "port"
-	UserField     string `yaml:"userField"` // 用户名字段名，如 "user"
-	PasswordField string `yaml:"passField"` // 密码字段名，如 "password"
+	ProxyListPath string `yaml:"path"`        // 代理列表的 JSON/XPATH 路径，如 "data.proxies"；regex 类型为正则表达式
+	IPField       string `yaml:"ipField"`     // IP 字段名，如 "ip"；regex 类型为分组名，csv 类型为列名或从 0 开始的列号
+	PortField     string `yaml:"portField"`   // Port 字段名，如 "port"
+	UserField     string `yaml:"userField"`   // 用户名字段名，如 "user"
+	PasswordField string `yaml:"passField"`   // 密码字段名，如 "password"
+	SchemeField   string `yaml:"schemeField"` // 协议字段名，如 "protocol"，未配置或字段缺失时使用 scheme
 }
 type Listener struct {
-	IP    string   `yaml:"ip"`
-	Port  int      `yaml:"port"`
-	Auths []string `yaml:"auths"`
+	IP       string    `yaml:"ip"`
+	Port     int       `yaml:"port"`
+	Auths    []string  `yaml:"auths"`
+	Timeouts *Timeouts `yaml:"timeouts"` // 实时拨号使用的超时
+
+	ShutdownTimeout int `yaml:"shutdownTimeout"` // 退出时等待活跃连接结束的最长时间(秒)
+
+	Quotas    map[string]*Quota `yaml:"quotas"`    // 认证用户名 -> 配额，"*" 作用于没有单独配置的用户
+	UsersFile string            `yaml:"usersFile"` // htpasswd 格式的用户文件，与 auths 同时生效，修改后自动重新加载
+
+	// 客户端访问控制，CIDR 或 IP，在 SOCKS5 握手之前检查
+	Allow      []string `yaml:"allow"`      // 只允许这些客户端连接，留空不限制
+	Deny       []string `yaml:"deny"`       // 拒绝这些客户端连接，优先于 allow
+	AuthExempt []string `yaml:"authExempt"` // 这些客户端无需认证，其余客户端必须认证
+
+	Destinations []*DestinationRule `yaml:"destinations"` // 目标地址规则，按顺序匹配，第一条匹配的规则生效，都不匹配时允许
+
+	DNS *DNS `yaml:"dns"` // 目标域名的解析方式，未配置时使用系统的解析器在本地解析
+}
+
+// DestinationRule 目标地址规则，配置的条件需要同时满足，cidrs 与 domains 满足其一即可
+type DestinationRule struct {
+	Action  string   `yaml:"action"`  // allow / deny，使用 preset 时默认为 deny
+	Preset  string   `yaml:"preset"`  // 内置规则，private 为本机、私有网络与链路本地地址
+	CIDRs   []string `yaml:"cidrs"`   // 目标 IP 所在的网段
+	Domains []string `yaml:"domains"` // 目标域名，支持通配符，如 *.example.com
+	Ports   []string `yaml:"ports"`   // 目标端口，支持范围如 8000-9000
+	Users   []string `yaml:"users"`   // 只对这些认证用户生效，留空对所有客户端生效
+}
+
+// Quota 单个认证用户的配额，零值表示不限制
+type Quota struct {
+	MaxConns          int      `yaml:"maxConns"`          // 最大并发连接数
+	RequestsPerSecond float64  `yaml:"requestsPerSecond"` // 每秒最多新建的连接数
+	BytesPerDay       string   `yaml:"bytesPerDay"`       // 每天的流量，如 500MB、10GB
+	BytesPerMonth     string   `yaml:"bytesPerMonth"`     // 每月的流量
+	AllowedPorts      []string `yaml:"allowedPorts"`      // 允许的目标端口，支持范围如 8000-9000，留空不限制
 }
 
 type CheckSock struct {
-	CheckURL         []string `yaml:"checkURL"`
-	CheckRspKeywords []string `yaml:"checkRspKeywords"`
-	MaxConcurrentReq int      `yaml:"maxConcurrentReq"`
-	CheckInterval    int      `yaml:"checkInterval"`
-	MinSize          int      `yaml:"minSize"`
+	CheckURL         []string  `yaml:"checkURL"`
+	CheckRspKeywords []string  `yaml:"checkRspKeywords"`
+	MaxConcurrentReq int       `yaml:"maxConcurrentReq"` // 检测最大并发
+	MinConcurrentReq int       `yaml:"minConcurrentReq"` // 自适应并发的下限
+	Adaptive         bool      `yaml:"adaptive"`         // 是否根据超时比例自适应调整并发(AIMD)
+	TimeoutRatio     float64   `yaml:"timeoutRatio"`     // 超时比例阈值，超过后并发减半
+	CheckInterval    int       `yaml:"checkInterval"`    // 默认的代理复检间隔(秒)
+	MinSize          int       `yaml:"minSize"`
+	Headroom         *int      `yaml:"headroom"`   // 存活数量低于 minSize 时补充到 minSize + headroom，避免在 minSize 附近反复获取，未配置时为 10，可以显式配置为 0
+	MaxLatency       int       `yaml:"maxLatency"` // 代理池可接受的最大延迟(毫秒)
+	Timeouts         *Timeouts `yaml:"timeouts"`   // 检测使用的超时
+	PreCheck         *PreCheck `yaml:"preCheck"`
+	DNS              *DNS      `yaml:"dns"` // 检测地址的解析方式，未配置时与监听相同，两者都未配置时交给代理解析
+}
+
+// PreCheck 分阶段轻量预检测配置：TCP 连接 -> SOCKS5 握手 -> CONNECT
+// 只有通过预检测的代理才会进入地理位置检测和完整的存活检测
+type PreCheck struct {
+	Enabled       bool   `yaml:"enabled"`
+	ConnectTarget string `yaml:"connectTarget"` // 第三阶段 CONNECT 的目标地址(host:port)
+}
+
+// Timeouts 连接各阶段的超时时间(秒)，0 表示不限制
+// 用于实时拨号时只有 connect、handshake、total 生效
+type Timeouts struct {
+	Connect   int `yaml:"connect"`   // TCP 连接超时
+	Handshake int `yaml:"handshake"` // SOCKS5 握手超时
+	TLS       int `yaml:"tls"`       // TLS 握手超时
+	FirstByte int `yaml:"firstByte"` // 首字节(响应头)超时
+	Total     int `yaml:"total"`     // 总超时
 }
 type CheckGeolocate struct {
 	Enabled                 bool     `yaml:"enabled"`